@@ -1,16 +1,64 @@
 package access
 
+import (
+	"encoding/json"
+	"net"
+	"time"
+
+	"github.com/stuart-warren/serveit/network"
+)
+
+// Special users a permit may allow or deny, besides emails and subjects. Emails may
+// contain * wildcards, such as *@example.com, which never match subjects.
+const (
+	// AllUsers is any verified identity, an alias of Authenticated
+	AllUsers = "ALL"
+	// Authenticated is any verified identity
+	Authenticated = "AUTHENTICATED"
+	// Anonymous is any client without a verified identity
+	Anonymous = "ANONYMOUS"
+)
+
 type Permitted struct {
 	methods []string
 	users   []string
 	groups  []string
+	// roles are defined centrally, see Roles
+	roles []string
+	// networks are CIDRs clients must be within, any if empty
+	networks []string
+	// nets and denyNets are networks and denyNetworks parsed once when they are added
+	nets     []*net.IPNet
+	denyNets []*net.IPNet
+	// the permit only applies between notBefore and notAfter, when either is set, and
+	// during any of schedules, if there are any
+	notBefore time.Time
+	notAfter  time.Time
+	schedules []string
+	// parsed holds schedules parsed once by AllowDuring, in the same order
+	parsed []Schedule
+	// denied entries override anything allowed
+	denyMethods  []string
+	denyUsers    []string
+	denyGroups   []string
+	denyNetworks []string
 }
 
 func BlankPermit() Permitted {
 	return Permitted{
-		methods: []string{},
-		users:   []string{},
-		groups:  []string{},
+		methods:      []string{},
+		users:        []string{},
+		groups:       []string{},
+		roles:        []string{},
+		networks:     []string{},
+		nets:         []*net.IPNet{},
+		schedules:    []string{},
+		parsed:       []Schedule{},
+		denyMethods:  []string{},
+		denyUsers:    []string{},
+		denyGroups:   []string{},
+		denyNetworks: []string{},
+		denyNets:     []*net.IPNet{},
 	}
 }
 
@@ -26,6 +74,60 @@ func (p Permitted) Groups() []string {
 	return p.groups
 }
 
+func (p Permitted) Roles() []string {
+	return p.roles
+}
+
+// Networks returns the CIDRs clients must be within, any client is permitted if empty
+func (p Permitted) Networks() []string {
+	return p.networks
+}
+
+// ParsedNetworks returns the networks parsed, see Networks
+func (p Permitted) ParsedNetworks() []*net.IPNet {
+	return p.nets
+}
+
+// NotBefore returns when the permit starts to apply, zero if it always has
+func (p Permitted) NotBefore() time.Time {
+	return p.notBefore
+}
+
+// NotAfter returns when the permit expires, zero if it never does
+func (p Permitted) NotAfter() time.Time {
+	return p.notAfter
+}
+
+func (p Permitted) Schedules() []string {
+	return p.schedules
+}
+
+// ParsedSchedules returns the schedules parsed, in the same order as Schedules
+func (p Permitted) ParsedSchedules() []Schedule {
+	return p.parsed
+}
+
+func (p Permitted) DeniedMethods() []string {
+	return p.denyMethods
+}
+
+func (p Permitted) DeniedUsers() []string {
+	return p.denyUsers
+}
+
+func (p Permitted) DeniedGroups() []string {
+	return p.denyGroups
+}
+
+func (p Permitted) DeniedNetworks() []string {
+	return p.denyNetworks
+}
+
+// ParsedDeniedNetworks returns the denied networks parsed, see DeniedNetworks
+func (p Permitted) ParsedDeniedNetworks() []*net.IPNet {
+	return p.denyNets
+}
+
 func (p Permitted) MethodRO() Permitted {
 	p.methods = []string{"HEAD", "GET"}
 	return p
@@ -41,6 +143,8 @@ func (p Permitted) AllowMethods(methods ...string) Permitted {
 	return p
 }
 
+// AllowUsers allows users by email or subject, which may be a pattern or one of the
+// special users such as Authenticated
 func (p Permitted) AllowUsers(users ...string) Permitted {
 	p.users = append(p.users, users...)
 	return p
@@ -50,3 +154,129 @@ func (p Permitted) AllowGroups(groups ...string) Permitted {
 	p.groups = append(p.groups, groups...)
 	return p
 }
+
+// AllowRoles allows users holding roles, or any role inheriting them, see Roles
+func (p Permitted) AllowRoles(roles ...string) Permitted {
+	p.roles = append(p.roles, roles...)
+	return p
+}
+
+// AllowNetworks restricts clients to those within cidrs, such as 10.0.0.0/8 or a single
+// address. See network.Resolver for how clients behind proxies are found. It panics if a
+// cidr is invalid.
+func (p Permitted) AllowNetworks(cidrs ...string) Permitted {
+	p.nets = append(p.nets, mustParseNetworks(cidrs)...)
+	p.networks = append(p.networks, cidrs...)
+	return p
+}
+
+func mustParseNetworks(cidrs []string) []*net.IPNet {
+	nets, err := network.ParseNetworks(cidrs...)
+	if err != nil {
+		panic(err)
+	}
+	return nets
+}
+
+// AllowFrom allows nothing before t
+func (p Permitted) AllowFrom(t time.Time) Permitted {
+	p.notBefore = t
+	return p
+}
+
+// AllowUntil allows nothing after t
+func (p Permitted) AllowUntil(t time.Time) Permitted {
+	p.notAfter = t
+	return p
+}
+
+// AllowDuring allows nothing outside schedules, see ParseSchedule. It panics if a
+// schedule is invalid.
+func (p Permitted) AllowDuring(schedules ...string) Permitted {
+	for _, s := range schedules {
+		sched, err := ParseSchedule(s)
+		if err != nil {
+			panic(err)
+		}
+		p.parsed = append(p.parsed, sched)
+	}
+	p.schedules = append(p.schedules, schedules...)
+	return p
+}
+
+// DenyMethods denies methods even if they are allowed
+func (p Permitted) DenyMethods(methods ...string) Permitted {
+	p.denyMethods = append(p.denyMethods, methods...)
+	return p
+}
+
+// DenyUsers denies users, which may be patterns or special users like in AllowUsers, even
+// if they are allowed, individually or by group
+func (p Permitted) DenyUsers(users ...string) Permitted {
+	p.denyUsers = append(p.denyUsers, users...)
+	return p
+}
+
+// DenyGroups denies members of groups even if they are allowed, individually or by group
+func (p Permitted) DenyGroups(groups ...string) Permitted {
+	p.denyGroups = append(p.denyGroups, groups...)
+	return p
+}
+
+// DenyNetworks denies clients within cidrs even if they are allowed. It panics if a cidr
+// is invalid.
+func (p Permitted) DenyNetworks(cidrs ...string) Permitted {
+	p.denyNets = append(p.denyNets, mustParseNetworks(cidrs)...)
+	p.denyNetworks = append(p.denyNetworks, cidrs...)
+	return p
+}
+
+// Equal reports whether p and q permit and deny the same methods, users, groups,
+// roles and networks at the same times, ignoring order
+func (p Permitted) Equal(q Permitted) bool {
+	return sameSet(p.methods, q.methods) && sameSet(p.users, q.users) && sameSet(p.groups, q.groups) &&
+		sameSet(p.roles, q.roles) && sameSet(p.networks, q.networks) &&
+		p.notBefore.Equal(q.notBefore) && p.notAfter.Equal(q.notAfter) && sameSet(p.schedules, q.schedules) &&
+		sameSet(p.denyMethods, q.denyMethods) && sameSet(p.denyUsers, q.denyUsers) &&
+		sameSet(p.denyGroups, q.denyGroups) && sameSet(p.denyNetworks, q.denyNetworks)
+}
+
+func sameSet(a, b []string) bool {
+	as := map[string]bool{}
+	for _, s := range a {
+		as[s] = true
+	}
+	bs := map[string]bool{}
+	for _, s := range b {
+		if !as[s] {
+			return false
+		}
+		bs[s] = true
+	}
+	return len(as) == len(bs)
+}
+
+func (p Permitted) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Methods      []string   `json:"methods"`
+		Users        []string   `json:"users"`
+		Groups       []string   `json:"groups"`
+		Roles        []string   `json:"roles,omitempty"`
+		Networks     []string   `json:"networks,omitempty"`
+		NotBefore    *time.Time `json:"notBefore,omitempty"`
+		NotAfter     *time.Time `json:"notAfter,omitempty"`
+		Schedules    []string   `json:"schedules,omitempty"`
+		DenyMethods  []string   `json:"denyMethods,omitempty"`
+		DenyUsers    []string   `json:"denyUsers,omitempty"`
+		DenyGroups   []string   `json:"denyGroups,omitempty"`
+		DenyNetworks []string   `json:"denyNetworks,omitempty"`
+	}{p.methods, p.users, p.groups, p.roles, p.networks, timeOrNil(p.notBefore), timeOrNil(p.notAfter), p.schedules,
+		p.denyMethods, p.denyUsers, p.denyGroups, p.denyNetworks})
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,134 @@
+package access
+
+import "fmt"
+
+// Role is a named set of users and groups, holding every role it inherits. Methods limits
+// what the role may do on routes permitting it, on top of the route's own methods.
+type Role struct {
+	Name     string
+	Inherits []string
+	Methods  []string
+	Users    []string
+	Groups   []string
+}
+
+// Roles are defined once and referenced by permits with AllowRoles. A role satisfies
+// itself and every role it inherits, directly or not, so with admin inheriting editor
+// and editor inheriting viewer an admin may use any route permitting viewers.
+type Roles struct {
+	// order is the order roles were defined in, which is also an order their
+	// inherited roles are defined before them in
+	order []string
+	roles map[string]Role
+}
+
+func NewRoles() Roles {
+	return Roles{order: []string{}, roles: map[string]Role{}}
+}
+
+// Define adds role, inheriting roles which must already be defined. It panics if role is
+// already defined or an inherited role is not, which also rules out cycles.
+func (rs Roles) Define(role string, inherits ...string) Roles {
+	rs, err := rs.Add(Role{Name: role, Inherits: inherits})
+	if err != nil {
+		panic(err)
+	}
+	return rs
+}
+
+// Add defines role like Define, returning an error instead of panicking
+func (rs Roles) Add(role Role) (Roles, error) {
+	if role.Name == "" {
+		return rs, fmt.Errorf("role has no name")
+	}
+	if _, ok := rs.roles[role.Name]; ok {
+		return rs, fmt.Errorf("role %q already defined", role.Name)
+	}
+	for _, name := range role.Inherits {
+		if _, ok := rs.roles[name]; !ok {
+			return rs, fmt.Errorf("role %q inherits undefined role %q", role.Name, name)
+		}
+	}
+	rs = rs.copy()
+	rs.order = append(rs.order, role.Name)
+	rs.roles[role.Name] = role
+	return rs, nil
+}
+
+// AllowMethods limits role to methods, any method the route permits is allowed if
+// neither the role nor those it inherits allow methods. It panics if role is undefined.
+func (rs Roles) AllowMethods(role string, methods ...string) Roles {
+	return rs.update(role, func(r *Role) { r.Methods = append(r.Methods, methods...) })
+}
+
+// AssignUsers gives users, by email or subject, role. It panics if role is undefined.
+func (rs Roles) AssignUsers(role string, users ...string) Roles {
+	return rs.update(role, func(r *Role) { r.Users = append(r.Users, users...) })
+}
+
+// AssignGroups gives members of groups role. It panics if role is undefined.
+func (rs Roles) AssignGroups(role string, groups ...string) Roles {
+	return rs.update(role, func(r *Role) { r.Groups = append(r.Groups, groups...) })
+}
+
+func (rs Roles) update(name string, f func(r *Role)) Roles {
+	r, ok := rs.roles[name]
+	if !ok {
+		panic(fmt.Sprintf("undefined role %q", name))
+	}
+	rs = rs.copy()
+	r.Inherits, r.Methods = append([]string{}, r.Inherits...), append([]string{}, r.Methods...)
+	r.Users, r.Groups = append([]string{}, r.Users...), append([]string{}, r.Groups...)
+	f(&r)
+	rs.roles[name] = r
+	return rs
+}
+
+func (rs Roles) copy() Roles {
+	c := Roles{order: append([]string{}, rs.order...), roles: map[string]Role{}}
+	for name, r := range rs.roles {
+		c.roles[name] = r
+	}
+	return c
+}
+
+// Names returns the defined roles in the order they were defined
+func (rs Roles) Names() []string {
+	return append([]string{}, rs.order...)
+}
+
+// Role returns the definition of the named role
+func (rs Roles) Role(name string) (Role, bool) {
+	r, ok := rs.roles[name]
+	return r, ok
+}
+
+// Satisfies returns role followed by every role it inherits, directly or not
+func (rs Roles) Satisfies(role string) []string {
+	out := []string{}
+	seen := map[string]bool{}
+	var walk func(name string)
+	walk = func(name string) {
+		r, ok := rs.roles[name]
+		if !ok || seen[name] {
+			return
+		}
+		seen[name] = true
+		out = append(out, name)
+		for _, i := range r.Inherits {
+			walk(i)
+		}
+	}
+	walk(role)
+	return out
+}
+
+// Methods returns the methods role allows, including those of the roles it inherits.
+// The role is not limited beyond the route's methods if there are none.
+func (rs Roles) Methods(role string) []string {
+	out := []string{}
+	for _, name := range rs.Satisfies(role) {
+		out = append(out, rs.roles[name].Methods...)
+	}
+	return out
+}
@@ -0,0 +1,150 @@
+package access
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schedule is a recurring window, such as weekdays from 08:00 to 18:00 in a timezone
+type Schedule struct {
+	// Days the window starts on, every day if empty
+	Days []time.Weekday
+	// Start and End are offsets from midnight, a window ending before it starts runs
+	// past midnight into the next day
+	Start, End time.Duration
+	Location   *time.Location
+}
+
+var days = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseSchedule parses schedules written as "[days] HH:MM-HH:MM [timezone]", for example
+// "Mon-Fri 08:00-18:00 Europe/London" or "Sat,Sun 22:00-06:00". Day ranges may wrap
+// around the week, the end time may be 24:00 and the timezone defaults to UTC.
+func ParseSchedule(s string) (Schedule, error) {
+	sched := Schedule{Location: time.UTC}
+	fields := strings.Fields(s)
+	window := -1
+	for i, f := range fields {
+		if strings.Contains(f, ":") {
+			window = i
+			break
+		}
+	}
+	if window < 0 || window > 1 || len(fields) > window+2 {
+		return Schedule{}, fmt.Errorf("invalid schedule %q, want [days] HH:MM-HH:MM [timezone]", s)
+	}
+	if window == 1 {
+		d, err := parseDays(fields[0])
+		if err != nil {
+			return Schedule{}, fmt.Errorf("invalid schedule %q: %v", s, err)
+		}
+		sched.Days = d
+	}
+	times := strings.Split(fields[window], "-")
+	if len(times) != 2 {
+		return Schedule{}, fmt.Errorf("invalid schedule %q: invalid times %q", s, fields[window])
+	}
+	var err error
+	if sched.Start, err = parseClock(times[0], false); err == nil {
+		sched.End, err = parseClock(times[1], true)
+	}
+	if err != nil {
+		return Schedule{}, fmt.Errorf("invalid schedule %q: %v", s, err)
+	}
+	if sched.Start == sched.End {
+		return Schedule{}, fmt.Errorf("invalid schedule %q: empty window", s)
+	}
+	if len(fields) > window+1 {
+		if sched.Location, err = time.LoadLocation(fields[window+1]); err != nil {
+			return Schedule{}, fmt.Errorf("invalid schedule %q: %v", s, err)
+		}
+	}
+	return sched, nil
+}
+
+func parseDays(s string) ([]time.Weekday, error) {
+	out := []time.Weekday{}
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.Split(part, "-")
+		if len(bounds) > 2 {
+			return nil, fmt.Errorf("invalid days %q", part)
+		}
+		from, ok := days[strings.ToLower(bounds[0])]
+		if !ok {
+			return nil, fmt.Errorf("invalid day %q", bounds[0])
+		}
+		to := from
+		if len(bounds) == 2 {
+			if to, ok = days[strings.ToLower(bounds[1])]; !ok {
+				return nil, fmt.Errorf("invalid day %q", bounds[1])
+			}
+		}
+		for d := from; ; d = (d + 1) % 7 {
+			out = append(out, d)
+			if d == to {
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+// parseClock parses HH:MM, allowing 24:00 at the end of a window
+func parseClock(s string, end bool) (time.Duration, error) {
+	if len(s) != 5 || s[2] != ':' || strings.Trim(s[:2]+s[3:], "0123456789") != "" {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	h, m := int(s[0]-'0')*10+int(s[1]-'0'), int(s[3]-'0')*10+int(s[4]-'0')
+	if m > 59 || h > 24 || h == 24 && (m != 0 || !end) {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// Contains reports whether t falls within the schedule
+func (s Schedule) Contains(t time.Time) bool {
+	loc := s.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	// a window that started yesterday may still be running
+	for _, start := range []time.Time{midnight, midnight.AddDate(0, 0, -1)} {
+		if !s.startsOn(start.Weekday()) {
+			continue
+		}
+		end := s.End
+		if end < s.Start {
+			end += 24 * time.Hour
+		}
+		from, to := clock(start, s.Start), clock(start, end)
+		if !t.Before(from) && t.Before(to) {
+			return true
+		}
+	}
+	return false
+}
+
+// clock returns the time offset from midnight on day, by the wall clock so windows keep
+// their hours across daylight saving changes
+func clock(day time.Time, offset time.Duration) time.Time {
+	h, m := int(offset/time.Hour), int(offset%time.Hour/time.Minute)
+	return time.Date(day.Year(), day.Month(), day.Day(), h, m, 0, 0, day.Location())
+}
+
+func (s Schedule) startsOn(d time.Weekday) bool {
+	if len(s.Days) == 0 {
+		return true
+	}
+	for _, day := range s.Days {
+		if day == d {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package access
+
+import "strings"
+
+// MatchUser reports whether a user a permit allows or denies matches a client, by email
+// or subject if it is authenticated. * in the user matches any run of characters of the
+// email only. See AllowUsers for the special users.
+func MatchUser(user string, authenticated bool, email, subject string) bool {
+	switch user {
+	case AllUsers, Authenticated:
+		return authenticated
+	case Anonymous:
+		return !authenticated
+	}
+	if !authenticated {
+		return false
+	}
+	if strings.Contains(user, "*") {
+		// only verified emails show domain membership, a subject may merely look like one
+		return email != "" && wildcard(user, email)
+	}
+	return email != "" && user == email || subject != "" && user == subject
+}
+
+// wildcard reports whether s matches pattern, where * matches any run of characters
+func wildcard(pattern, s string) bool {
+	star := strings.IndexByte(pattern, '*')
+	if star < 0 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, pattern[:star]) {
+		return false
+	}
+	s, pattern = s[star:], pattern[star+1:]
+	for i := 0; i <= len(s); i++ {
+		if wildcard(pattern, s[i:]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+// Package audit writes the router's authorization decisions to an append-only JSON lines
+// file, for router.WithAuditor.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/stuart-warren/serveit/router"
+)
+
+// File appends audit records to a file, one JSON object per line, rotating it when it
+// grows too large
+type File struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	backups  int
+	f        *os.File
+	size     int64
+	closed   bool
+}
+
+// NewFile opens path for appending, creating it if needed. Once it reaches maxBytes it
+// is renamed path.1, with older files renamed path.2 and so on, keeping backups old files
+// and deleting older ones. It is never rotated if maxBytes is zero, otherwise backups
+// must be at least one so a rotation never deletes the records just written.
+func NewFile(path string, maxBytes int64, backups int) (*File, error) {
+	if maxBytes < 0 || maxBytes > 0 && backups < 1 {
+		return nil, fmt.Errorf("audit file %s: rotating at %d bytes needs at least one backup", path, maxBytes)
+	}
+	a := &File{path: path, maxBytes: maxBytes, backups: backups}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *File) open() error {
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	a.f, a.size = f, info.Size()
+	return nil
+}
+
+// Audit appends record as a line of JSON. A failed rotation is reported after the
+// record is written to the current file.
+func (a *File) Audit(record router.AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return fmt.Errorf("audit file %s is closed", a.path)
+	}
+	var rerr error
+	if a.f != nil && a.maxBytes > 0 && a.size > 0 && a.size+int64(len(line)) > a.maxBytes {
+		rerr = a.rotate()
+	}
+	if a.f == nil {
+		// a previous rotation couldn't reopen the file
+		if err := a.open(); err != nil {
+			return err
+		}
+	}
+	n, err := a.f.Write(line)
+	a.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return rerr
+}
+
+// rotate shifts each backup up one, dropping the oldest, and starts a new file. The file
+// is reopened whatever happens, so a failed rotation doesn't stop auditing.
+func (a *File) rotate() error {
+	err := a.f.Close()
+	a.f = nil
+	if err == nil {
+		err = a.shift()
+	}
+	if oerr := a.open(); err == nil {
+		err = oerr
+	}
+	return err
+}
+
+func (a *File) shift() error {
+	for i := a.backups - 1; i > 0; i-- {
+		if err := os.Rename(backup(a.path, i), backup(a.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(a.path, backup(a.path, 1))
+}
+
+func backup(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// Close closes the file, later records are an error
+func (a *File) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.closed = true
+	if a.f == nil {
+		return nil
+	}
+	err := a.f.Close()
+	a.f = nil
+	return err
+}
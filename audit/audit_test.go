@@ -0,0 +1,152 @@
+package audit_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stuart-warren/serveit/access"
+	"github.com/stuart-warren/serveit/audit"
+	"github.com/stuart-warren/serveit/identity"
+	"github.com/stuart-warren/serveit/router"
+	"github.com/stuart-warren/serveit/rules"
+)
+
+func records(t *testing.T, path string) []map[string]interface{} {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	out := []map[string]interface{}{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		record := map[string]interface{}{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("%v: %s", err, scanner.Text())
+		}
+		out = append(out, record)
+	}
+	return out
+}
+
+func TestAuditDecisions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	sink, err := audit.NewFile(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	mux := router.NewRuleRouter(ok, rules.All(rules.Method, rules.User)).WithAuditor(sink)
+	mux.Handle(router.NewPrefixRoute("/access/").Permit(access.BlankPermit().MethodRW().AllowUsers("some.admin@example.com")))
+
+	for _, email := range []string{"some.admin@example.com", "someone@example.com"} {
+		r := httptest.NewRequest("PUT", "/access/x", nil)
+		r = r.WithContext(identity.NewContext(r.Context(), identity.Identity{Email: email, Groups: []string{"staff"}, Method: "oidc"}))
+		mux.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	// no route, so no decision to record
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/other", nil))
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := records(t, path)
+	if len(got) != 2 {
+		t.Fatalf("got %v", got)
+	}
+	if got[0]["email"] != "some.admin@example.com" || got[0]["allowed"] != true || got[0]["route"] != "/access/" ||
+		got[0]["rule"] != "all" || got[0]["path"] != "/access/x" || got[0]["time"] == "" {
+		t.Errorf("got %v", got[0])
+	}
+	if got[1]["email"] != "someone@example.com" || got[1]["allowed"] != false || got[1]["status"] != float64(403) {
+		t.Errorf("got %v", got[1])
+	}
+	if users := got[1]["permitted"].(map[string]interface{})["users"].([]interface{}); users[0] != "some.admin@example.com" {
+		t.Errorf("got %v", got[1]["permitted"])
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	sink, err := audit.NewFile(path, 500, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	for i := 0; i < 10; i++ {
+		if err := sink.Audit(router.AuditRecord{Method: "GET", Path: "/", Route: "/"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() == 0 || info.Size() > 500 {
+			t.Errorf("%s is %d bytes", p, info.Size())
+		}
+		records(t, p)
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("kept too many backups: %v", err)
+	}
+}
+
+func TestRotateFailureKeepsAuditing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	if _, err := audit.NewFile(path, 500, 0); err == nil {
+		t.Error("rotating without backups would delete audit records")
+	}
+	sink, err := audit.NewFile(path, 500, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	// a non-empty directory in the way of the backup makes rotation fail
+	if err := os.MkdirAll(filepath.Join(path+".1", "x"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	failed := 0
+	for i := 0; i < 10; i++ {
+		if err := sink.Audit(router.AuditRecord{Method: "GET", Path: "/", Route: "/"}); err != nil {
+			failed++
+		}
+	}
+	if failed == 0 {
+		t.Error("rotation didn't fail")
+	}
+	if got := records(t, path); len(got) != 10 {
+		t.Errorf("got %d records", len(got))
+	}
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Audit(router.AuditRecord{Method: "GET", Path: "/", Route: "/"}); err != nil {
+		t.Errorf("didn't recover: %v", err)
+	}
+	if got := records(t, path+".1"); len(got) != 10 {
+		t.Errorf("got %d backed up records", len(got))
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/stuart-warren/serveit/access"
 	"github.com/stuart-warren/serveit/middleware"
+	"github.com/stuart-warren/serveit/network"
 	"github.com/stuart-warren/serveit/router"
 	"github.com/stuart-warren/serveit/rules"
 
@@ -16,15 +17,11 @@ import (
 func main() {
 	wd, _ := os.Getwd()
 	static := http.FileServer(http.Dir(wd))
-	metricMux := router.NewRouter(promhttp.Handler(), rules.AllowAll)
-	metricMux.Handle(router.NewPrefixRoute("/metrics").Permit(access.BlankPermit().MethodRO().AllowUsers("ALL")))
 	phm := middleware.NewPrometheusHttpMetric("serveit", []float64{50.0, 90.0, 95.0, 99.0, 99.999})
-	rootMux := router.NewRouter(static, rules.CheckUser)
-	rootMux.Handle(router.NewPrefixRoute("/access/").Permit(access.BlankPermit().MethodRW().AllowUsers("some.admin")))
-	rootMux.Handle(router.NewPrefixRoute("/").Permit(access.BlankPermit().MethodRO().AllowUsers("ALL")))
-	mux := http.NewServeMux()
-	mux.Handle("/metrics", metricMux)
-	mux.Handle("/", rootMux)
+	mux := router.NewRuleRouter(static, rules.All(rules.Method, rules.Network, rules.User)).WithTrustedProxies(network.XForwardedFor, "127.0.0.1")
+	mux.Handle(router.NewPrefixRoute("/metrics").MethodHandler(http.MethodGet, promhttp.Handler()).Permit(access.BlankPermit().MethodRO().AllowUsers("ANONYMOUS", "AUTHENTICATED").AllowNetworks("127.0.0.1", "10.0.0.0/8")))
+	mux.Handle(router.NewPrefixRoute("/access/").Permit(access.BlankPermit().MethodRW().AllowUsers("some.admin")))
+	mux.Handle(router.NewPrefixRoute("/").Permit(access.BlankPermit().MethodRO().AllowUsers("ANONYMOUS", "AUTHENTICATED")))
 	srv := &http.Server{Addr: ":1234", Handler: middleware.Decorate(mux, phm.For("/"), middleware.Logging())}
 	log.Printf("starting at %s\n", srv.Addr)
 	log.Fatal(srv.ListenAndServe())
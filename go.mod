@@ -1,5 +1,7 @@
 module github.com/stuart-warren/serveit
 
+go 1.16
+
 require (
 	github.com/coreos/go-oidc v2.0.0+incompatible
 	github.com/miscreant/miscreant-go v0.0.0-20181010193435-325cbd69228b // indirect
@@ -0,0 +1,83 @@
+package identity
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// UserHeader is the header the user's name is passed to upstream handlers in. It is
+// never trusted on incoming requests, authenticators strip it and set an Identity.
+const UserHeader = "User"
+
+// Identity is who an authenticator has verified made the request
+type Identity struct {
+	Subject string
+	Email   string
+	Groups  []string
+	// Method is how the identity was established, such as oidc
+	Method string
+	// Expiry is when the credentials the identity came from expire, zero if they don't
+	Expiry time.Time
+}
+
+// Name returns the email address if known, or the subject
+func (id Identity) Name() string {
+	if id.Email != "" {
+		return id.Email
+	}
+	return id.Subject
+}
+
+// InGroup reports whether the identity is a member of any of groups
+func (id Identity) InGroup(groups ...string) bool {
+	for _, g := range groups {
+		for _, member := range id.Groups {
+			if g == member {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type identityKey struct{}
+
+type trackerKey struct{}
+
+// NewContext returns a copy of ctx carrying id, also recording it for Tracked
+func NewContext(ctx context.Context, id Identity) context.Context {
+	if t, ok := ctx.Value(trackerKey{}).(*Identity); ok {
+		*t = id
+	}
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity stored in ctx, if any
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// FromRequest returns the identity an authenticator stored in the request context, if any
+func FromRequest(r *http.Request) (Identity, bool) {
+	return FromContext(r.Context())
+}
+
+// Track returns a copy of ctx in which identities stored by handlers further down the
+// chain can be seen with Tracked, for middleware such as logging that runs around them
+func Track(ctx context.Context) context.Context {
+	return context.WithValue(ctx, trackerKey{}, &Identity{})
+}
+
+// Tracked returns the last identity stored in a context derived from ctx, see Track
+func Tracked(ctx context.Context) (Identity, bool) {
+	if id, ok := FromContext(ctx); ok {
+		return id, true
+	}
+	t, ok := ctx.Value(trackerKey{}).(*Identity)
+	if !ok || t.Name() == "" && t.Method == "" {
+		return Identity{}, false
+	}
+	return *t, true
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import "strings"
+
+// claimStrings returns the strings found at path in claims, where path is a claim name
+// or a dotted path into nested claims such as realm_access.roles
+func claimStrings(claims map[string]interface{}, path string) []string {
+	var value interface{} = claims
+	for _, name := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[name]
+	}
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
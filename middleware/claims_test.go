@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestClaimStrings(t *testing.T) {
+	var claims map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"email": "some.admin@example.com",
+		"groups": ["admins", "staff", 42],
+		"role": "editor",
+		"realm_access": {"roles": ["viewer", "editor"]}
+	}`), &claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"groups", []string{"admins", "staff"}},
+		{"role", []string{"editor"}},
+		{"realm_access.roles", []string{"viewer", "editor"}},
+		{"realm_access.missing", nil},
+		{"email.nested", nil},
+		{"missing", nil},
+	}
+	for _, tt := range tests {
+		if got := claimStrings(claims, tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
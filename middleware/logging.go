@@ -4,6 +4,8 @@ import (
 	"log"
 	"net/http"
 	"time"
+
+	"github.com/stuart-warren/serveit/identity"
 )
 
 type loggingResponseWriter struct {
@@ -25,10 +27,12 @@ func Logging() func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			t1 := time.Now()
 			lrw := NewLoggingResponseWriter(w)
+			r = r.WithContext(identity.Track(r.Context()))
 			next.ServeHTTP(lrw, r)
 			t2 := time.Now()
 			statusCode := lrw.statusCode
-			log.Printf("[%s] %q %q %v %d", r.Method, r.URL.String(), r.Header.Get("User"), t2.Sub(t1), statusCode)
+			id, _ := identity.Tracked(r.Context())
+			log.Printf("[%s] %q %q %v %d", r.Method, r.URL.String(), id.Name(), t2.Sub(t1), statusCode)
 		})
 	}
 }
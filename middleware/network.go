@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/stuart-warren/serveit/network"
+)
+
+// ClientIP resolves the client address and scheme of each request for rules and
+// matchers, trusting forwarding headers only from proxies res trusts
+func ClientIP(res network.Resolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := network.NewContext(r.Context(), res.ClientIP(r))
+			next.ServeHTTP(w, r.WithContext(network.NewSchemeContext(ctx, res.Scheme(r))))
+		})
+	}
+}
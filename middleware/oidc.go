@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/stuart-warren/serveit/identity"
 	"github.com/stuart-warren/serveit/oidc"
 )
 
@@ -22,6 +23,7 @@ type OIDCMiddlewareConfig struct {
 	dontRedirect []string
 	secureCookie bool
 	now          func() time.Time
+	groupsClaim  string
 }
 
 func NewOIDCMiddlewareConfig(oidcAuth Verifier) OIDCMiddlewareConfig {
@@ -31,12 +33,22 @@ func NewOIDCMiddlewareConfig(oidcAuth Verifier) OIDCMiddlewareConfig {
 		secureCookie: true,
 		dontRedirect: []string{"/auth", "/callback"},
 		redirectTo:   "/auth",
+		groupsClaim:  "groups",
 	}
 }
 
+// WithGroupsClaim sets the ID token claim groups are read from, nested claims are
+// given as a dotted path such as realm_access.roles
+func (c OIDCMiddlewareConfig) WithGroupsClaim(claim string) OIDCMiddlewareConfig {
+	c.groupsClaim = claim
+	return c
+}
+
 func OIDC(c OIDCMiddlewareConfig) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// only a verified token may say who the user is
+			r.Header.Del(identity.UserHeader)
 			for _, cookie := range r.Cookies() {
 				if cookie.Name == oidc.JWTCookie {
 					jwt, err := base64.URLEncoding.DecodeString(cookie.Value)
@@ -55,9 +67,21 @@ func OIDC(c OIDCMiddlewareConfig) func(http.Handler) http.Handler {
 						EmailVerified bool   `json:"email_verified"`
 					}
 					err = tkn.Claims(&claims)
+					var raw map[string]interface{}
+					tkn.Claims(&raw)
+					id := identity.Identity{
+						Subject: tkn.Subject,
+						Groups:  claimStrings(raw, c.groupsClaim),
+						Method:  "oidc",
+						Expiry:  tkn.Expiry,
+					}
 					if claims.EmailVerified {
-						r.Header.Set("User", claims.Email)
+						id.Email = claims.Email
+					}
+					if name := id.Name(); name != "" {
+						r.Header.Set(identity.UserHeader, name)
 					}
+					r = r.WithContext(identity.NewContext(r.Context(), id))
 					r.Header.Set("Authorisation", fmt.Sprintf("Bearer %s", jwt))
 					w.Header().Set(oidc.JWTHeader, string(jwt))
 					next.ServeHTTP(w, r)
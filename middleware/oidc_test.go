@@ -43,3 +43,18 @@ func TestOIDCMiddleware(t *testing.T) {
 
 	//FIXME this doesn't actually test anything
 }
+
+func TestOIDCMiddlewareStripsUserHeader(t *testing.T) {
+	var got string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("User")
+	})
+	h := middleware.OIDC(middleware.NewOIDCMiddlewareConfig(MockVerifier{}))(next)
+
+	req := httptest.NewRequest("GET", "/callback", nil)
+	req.Header.Set("User", "some.admin")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if got != "" {
+		t.Errorf("passed on User header %q", got)
+	}
+}
@@ -0,0 +1,251 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseNetworks parses CIDRs such as 10.0.0.0/8, a bare IP address is a network of one
+func ParseNetworks(cidrs ...string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		if !strings.Contains(c, "/") {
+			ip := net.ParseIP(c)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid network %q", c)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// Contains reports whether ip is in any of nets
+func Contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Header is the header trusted proxies report the addresses they forward for in
+type Header int
+
+const (
+	// XForwardedFor is the X-Forwarded-For header most proxies append to
+	XForwardedFor Header = iota
+	// Forwarded is the RFC 7239 Forwarded header's for= parameters
+	Forwarded
+)
+
+// ClientIn reports whether the client of r is within any of nets, with a reason naming
+// the client and any network it is in. ok is false if the client is unknown.
+func ClientIn(r *http.Request, nets []*net.IPNet) (in bool, reason string, ok bool) {
+	ip := ClientIP(r)
+	if ip == nil {
+		return false, "unknown client", false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true, fmt.Sprintf("client %v in %q", ip, n), true
+		}
+	}
+	return false, fmt.Sprintf("client %v", ip), true
+}
+
+// Resolver finds the client address of requests, believing the header trusted proxies
+// report it in only as far back as they added to it
+type Resolver struct {
+	header  Header
+	trusted []*net.IPNet
+}
+
+// NewResolver returns a Resolver trusting proxies in the given networks to report the
+// addresses they forward for in header. The other header is never read, as proxies pass
+// it on unchanged from clients.
+func NewResolver(header Header, trustedProxies ...string) (Resolver, error) {
+	nets, err := ParseNetworks(trustedProxies...)
+	if err != nil {
+		return Resolver{}, err
+	}
+	return Resolver{header: header, trusted: nets}, nil
+}
+
+// ClientIP returns the address of the client that made r. If the peer is a trusted proxy
+// the trusted header is read right to left, skipping trusted proxies, and the first
+// untrusted address is the client. It returns nil if a forwarded address can't be parsed.
+func (res Resolver) ClientIP(r *http.Request) net.IP {
+	ip, _ := res.client(r)
+	return ip
+}
+
+// Scheme returns the scheme, http or https, the client that made r used. If the peer is
+// a trusted proxy it is the proto= beside the client's for= in Forwarded, or the last
+// X-Forwarded-Proto, otherwise the scheme of the connection.
+func (res Resolver) Scheme(r *http.Request) string {
+	ip, hop := res.client(r)
+	if ip == nil || hop < 0 {
+		return connScheme(r)
+	}
+	proto := ""
+	if res.header == XForwardedFor {
+		if protos := splitHeader(r.Header, "X-Forwarded-Proto"); len(protos) > 0 {
+			proto = protos[len(protos)-1]
+		}
+	} else if hops := forwarded(r.Header); hop >= 0 && hop < len(hops) {
+		proto = hops[hop].proto
+	}
+	switch proto = strings.ToLower(proto); proto {
+	case "http", "https":
+		return proto
+	}
+	return connScheme(r)
+}
+
+// client returns the client address of r and the index of the hop it was read from, -1
+// if the peer isn't trusted
+func (res Resolver) client(r *http.Request) (net.IP, int) {
+	ip := peerIP(r.RemoteAddr)
+	if ip == nil || !Contains(res.trusted, ip) {
+		return ip, -1
+	}
+	hops := forwardedFor(r.Header)
+	if res.header == XForwardedFor {
+		hops = xForwardedFor(r.Header)
+	}
+	hop := len(hops) - 1
+	for ; hop >= 0; hop-- {
+		ip = parseHop(hops[hop])
+		if ip == nil || !Contains(res.trusted, ip) {
+			return ip, hop
+		}
+	}
+	return ip, hop + 1
+}
+
+func connScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// forwardedHop is a Forwarded element with a for= parameter
+type forwardedHop struct {
+	addr, proto string
+}
+
+// forwarded returns the Forwarded elements with for= parameters, oldest first
+func forwarded(h http.Header) []forwardedHop {
+	hops := []forwardedHop{}
+	for _, element := range splitHeader(h, "Forwarded") {
+		hop, ok := forwardedHop{}, false
+		for _, pair := range strings.Split(element, ";") {
+			pair = strings.TrimSpace(pair)
+			switch {
+			case len(pair) > 4 && strings.EqualFold(pair[:4], "for="):
+				hop.addr, ok = strings.Trim(pair[4:], `"`), true
+			case len(pair) > 6 && strings.EqualFold(pair[:6], "proto="):
+				hop.proto = strings.Trim(pair[6:], `"`)
+			}
+		}
+		if ok {
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// forwardedFor returns the addresses in Forwarded for= parameters, oldest first
+func forwardedFor(h http.Header) []string {
+	hops := []string{}
+	for _, hop := range forwarded(h) {
+		hops = append(hops, hop.addr)
+	}
+	return hops
+}
+
+// splitHeader returns the comma separated values of every header name
+func splitHeader(h http.Header, name string) []string {
+	values := []string{}
+	for _, v := range h[name] {
+		for _, value := range strings.Split(v, ",") {
+			values = append(values, strings.TrimSpace(value))
+		}
+	}
+	return values
+}
+
+// xForwardedFor returns the addresses in X-Forwarded-For, oldest first
+func xForwardedFor(h http.Header) []string {
+	return splitHeader(h, "X-Forwarded-For")
+}
+
+// parseHop parses an address with an optional port, IPv6 addresses may be in brackets
+func parseHop(hop string) net.IP {
+	if ip := net.ParseIP(hop); ip != nil {
+		return ip
+	}
+	return peerIP(hop)
+}
+
+func peerIP(addr string) net.IP {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = strings.Trim(addr, "[]")
+	}
+	return net.ParseIP(host)
+}
+
+type clientKey struct{}
+
+// NewContext returns a copy of ctx carrying the resolved client address
+func NewContext(ctx context.Context, ip net.IP) context.Context {
+	return context.WithValue(ctx, clientKey{}, ip)
+}
+
+type schemeKey struct{}
+
+// NewSchemeContext returns a copy of ctx carrying the resolved scheme
+func NewSchemeContext(ctx context.Context, scheme string) context.Context {
+	return context.WithValue(ctx, schemeKey{}, scheme)
+}
+
+// Scheme returns the scheme resolved for r, or the scheme of the connection if no
+// Resolver has run
+func Scheme(r *http.Request) string {
+	if scheme, ok := r.Context().Value(schemeKey{}).(string); ok {
+		return scheme
+	}
+	return connScheme(r)
+}
+
+// FromRequest returns the client address a Resolver found for r, ok is false if none has run
+func FromRequest(r *http.Request) (ip net.IP, ok bool) {
+	ip, ok = r.Context().Value(clientKey{}).(net.IP)
+	return ip, ok
+}
+
+// ClientIP returns the client address resolved for r, or the peer address if no Resolver
+// has run. It returns nil if neither is known.
+func ClientIP(r *http.Request) net.IP {
+	if ip, ok := FromRequest(r); ok {
+		return ip
+	}
+	return peerIP(r.RemoteAddr)
+}
@@ -0,0 +1,453 @@
+// Package policy loads routes and their permits from a JSON policy file, and dumps the
+// routes a router serves back to the same format.
+//
+//	{
+//	  "roles": [
+//	    {"name": "viewer", "methods": ["GET", "HEAD"], "groups": ["staff"]},
+//	    {"name": "editor", "inherits": ["viewer"], "methods": ["PUT", "POST"], "users": ["some.editor"]}
+//	  ],
+//	  "routes": [
+//	    {"type": "prefix", "path": "/docs/", "methods": ["GET", "HEAD", "PUT", "POST"], "roles": ["viewer"]},
+//	    {"type": "prefix", "path": "/access/", "methods": ["GET", "PUT"], "users": ["some.admin"]},
+//	    {"type": "prefix", "path": "/", "hosts": ["docs.example.com"], "methods": ["GET"], "users": ["ANONYMOUS", "AUTHENTICATED"]}
+//	  ]
+//	}
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/stuart-warren/serveit/access"
+	"github.com/stuart-warren/serveit/network"
+	"github.com/stuart-warren/serveit/router"
+)
+
+// Policy is the contents of a policy file
+type Policy struct {
+	Roles  []Role  `json:"roles,omitempty"`
+	Routes []Route `json:"routes"`
+}
+
+// Role describes an access.Role, inherited roles must be defined earlier in the file
+type Role struct {
+	Name     string   `json:"name"`
+	Inherits []string `json:"inherits,omitempty"`
+	Methods  []string `json:"methods,omitempty"`
+	Users    []string `json:"users,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+
+	line int
+}
+
+// Route describes a router.Route and its permits
+type Route struct {
+	// Type is one of text, prefix, pattern, glob or regex, see router.KindOf
+	Type    string   `json:"type"`
+	Path    string   `json:"path"`
+	Hosts   []string `json:"hosts,omitempty"`
+	Methods []string `json:"methods"`
+	Users   []string `json:"users,omitempty"`
+	Groups  []string `json:"groups,omitempty"`
+	// Roles must be defined in the policy's roles if it has any
+	Roles []string `json:"roles,omitempty"`
+	// Networks are CIDRs or addresses clients must be within
+	Networks []string `json:"networks,omitempty"`
+	// the route is only permitted between NotBefore and NotAfter, in RFC 3339 format,
+	// and during any Schedules, see access.ParseSchedule
+	NotBefore *time.Time `json:"notBefore,omitempty"`
+	NotAfter  *time.Time `json:"notAfter,omitempty"`
+	Schedules []string   `json:"schedules,omitempty"`
+	// denied methods, users, groups and networks override anything allowed
+	DenyMethods  []string `json:"denyMethods,omitempty"`
+	DenyUsers    []string `json:"denyUsers,omitempty"`
+	DenyGroups   []string `json:"denyGroups,omitempty"`
+	DenyNetworks []string `json:"denyNetworks,omitempty"`
+	// Handler names one of the handlers given to Build, the router's default is used if empty
+	Handler  string `json:"handler,omitempty"`
+	Redirect string `json:"redirect,omitempty"`
+	Code     int    `json:"code,omitempty"`
+	Rewrite  string `json:"rewrite,omitempty"`
+
+	line int
+}
+
+// Error is a problem with a policy file, at line if known
+type Error struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.File != "" && e.Line > 0:
+		return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+	case e.Line > 0:
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	case e.File != "":
+		return fmt.Sprintf("%s: %v", e.File, e.Err)
+	}
+	return e.Err.Error()
+}
+
+var method = regexp.MustCompile(`^[A-Z]+$`)
+
+// Parse strictly decodes and validates a policy, rejecting unknown fields
+func Parse(data []byte) (Policy, error) {
+	p := Policy{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	fail := func(offset int64, err error) (Policy, error) {
+		if serr, ok := err.(*json.SyntaxError); ok {
+			// the offending character is the last one read
+			offset = serr.Offset - 1
+		}
+		if terr, ok := err.(*json.UnmarshalTypeError); ok {
+			offset = terr.Offset
+		}
+		return Policy{}, &Error{Line: lineOf(data, offset), Err: err}
+	}
+	if err := expect(dec, json.Delim('{')); err != nil {
+		return fail(dec.InputOffset(), err)
+	}
+	seen := map[string]bool{}
+	for dec.More() {
+		offset := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			return fail(offset, err)
+		}
+		field, _ := tok.(string)
+		if field != "roles" && field != "routes" || seen[field] {
+			return fail(offset, fmt.Errorf("unexpected field %v", tok))
+		}
+		seen[field] = true
+		if err := expect(dec, json.Delim('[')); err != nil {
+			return fail(dec.InputOffset(), err)
+		}
+		for dec.More() {
+			offset := dec.InputOffset()
+			if field == "roles" {
+				r := Role{}
+				if err := dec.Decode(&r); err != nil {
+					return fail(offset, err)
+				}
+				r.line = lineOf(data, offset)
+				p.Roles = append(p.Roles, r)
+				continue
+			}
+			r := Route{}
+			if err := dec.Decode(&r); err != nil {
+				return fail(offset, err)
+			}
+			r.line = lineOf(data, offset)
+			if err := r.validate(); err != nil {
+				return Policy{}, &Error{Line: r.line, Err: err}
+			}
+			p.Routes = append(p.Routes, r)
+		}
+		if err := expect(dec, json.Delim(']')); err != nil {
+			return fail(dec.InputOffset(), err)
+		}
+	}
+	if err := expect(dec, json.Delim('}')); err != nil {
+		return fail(dec.InputOffset(), err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fail(dec.InputOffset(), fmt.Errorf("unexpected data after policy"))
+	}
+	if err := p.validateRoles(); err != nil {
+		return Policy{}, err
+	}
+	return p, nil
+}
+
+// validateRoles checks the roles can be built and, if there are any, that routes only
+// permit roles they define
+func (p Policy) validateRoles() error {
+	roles, err := p.AccessRoles()
+	if err != nil || len(p.Roles) == 0 {
+		return err
+	}
+	for _, r := range p.Routes {
+		for _, name := range r.Roles {
+			if _, ok := roles.Role(name); !ok {
+				return &Error{Line: r.line, Err: fmt.Errorf("route %q: undefined role %q", r.Path, name)}
+			}
+		}
+	}
+	return nil
+}
+
+// AccessRoles returns the policy's roles, for rules.Role
+func (p Policy) AccessRoles() (access.Roles, error) {
+	roles := access.NewRoles()
+	for _, r := range p.Roles {
+		for _, m := range r.Methods {
+			if !method.MatchString(m) {
+				return access.Roles{}, &Error{Line: r.line, Err: fmt.Errorf("role %q: invalid method %q", r.Name, m)}
+			}
+		}
+		var err error
+		roles, err = roles.Add(access.Role{Name: r.Name, Inherits: r.Inherits, Methods: r.Methods, Users: r.Users, Groups: r.Groups})
+		if err != nil {
+			return access.Roles{}, &Error{Line: r.line, Err: err}
+		}
+	}
+	return roles, nil
+}
+
+func expect(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("expected %v, found %v", delim, tok)
+	}
+	return nil
+}
+
+// lineOf returns the line of the first non-space character at or after offset
+func lineOf(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	for offset < int64(len(data)) && strings.IndexByte(" \t\r\n,", data[offset]) >= 0 {
+		offset++
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+func (r Route) validate() error {
+	if r.Path == "" {
+		return fmt.Errorf("route has no path")
+	}
+	if _, err := r.route(); err != nil {
+		return err
+	}
+	if len(r.Methods) == 0 {
+		return fmt.Errorf("route %q permits no methods", r.Path)
+	}
+	for _, m := range append(append([]string{}, r.Methods...), r.DenyMethods...) {
+		if !method.MatchString(m) {
+			return fmt.Errorf("route %q: invalid method %q", r.Path, m)
+		}
+	}
+	for _, h := range r.Hosts {
+		if h == "" || strings.ContainsAny(h, "/ ") || strings.Contains(h[1:], "*") {
+			return fmt.Errorf("route %q: invalid host %q", r.Path, h)
+		}
+	}
+	for _, names := range [][]string{r.Users, r.Groups, r.Roles, r.DenyUsers, r.DenyGroups} {
+		for _, name := range names {
+			if strings.TrimSpace(name) == "" {
+				return fmt.Errorf("route %q: empty user, group or role", r.Path)
+			}
+		}
+	}
+	for _, cidrs := range [][]string{r.Networks, r.DenyNetworks} {
+		if _, err := network.ParseNetworks(cidrs...); err != nil {
+			return fmt.Errorf("route %q: %v", r.Path, err)
+		}
+	}
+	if r.NotBefore != nil && r.NotAfter != nil && !r.NotBefore.Before(*r.NotAfter) {
+		return fmt.Errorf("route %q: notBefore is not before notAfter", r.Path)
+	}
+	for _, sched := range r.Schedules {
+		if _, err := access.ParseSchedule(sched); err != nil {
+			return fmt.Errorf("route %q: %v", r.Path, err)
+		}
+	}
+	switch {
+	case r.Redirect != "" && r.Rewrite != "":
+		return fmt.Errorf("route %q both redirects and rewrites", r.Path)
+	case r.Redirect != "":
+		switch r.Code {
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			return fmt.Errorf("route %q: invalid redirect code %d", r.Path, r.Code)
+		}
+	case r.Code != 0:
+		return fmt.Errorf("route %q has a code but no redirect", r.Path)
+	}
+	return nil
+}
+
+// route returns the router.Route for the type and path alone
+func (r Route) route() (router.Route, error) {
+	switch r.Type {
+	case router.TextKind:
+		return router.NewTextRoute(r.Path), nil
+	case router.PrefixKind:
+		return router.NewPrefixRoute(r.Path), nil
+	case router.PatternKind:
+		return router.CompilePatternRoute(r.Path)
+	case router.GlobKind:
+		return router.CompileGlobRoute(r.Path)
+	case router.RegexKind:
+		re, err := regexp.Compile(r.Path)
+		if err != nil {
+			return nil, err
+		}
+		return router.NewRegexRoute(re), nil
+	case "":
+		return nil, fmt.Errorf("route %q has no type", r.Path)
+	}
+	return nil, fmt.Errorf("route %q has unknown type %q", r.Path, r.Type)
+}
+
+// Build returns a table of the policy's routes, with handlers named by routes taken
+// from handlers. Swap it into a router with Router.Replace.
+func (p Policy) Build(handlers map[string]http.Handler) (*router.Table, error) {
+	t := router.NewTable()
+	for _, r := range p.Routes {
+		rt, err := r.route()
+		if err != nil {
+			return nil, &Error{Line: r.line, Err: err}
+		}
+		permit := access.BlankPermit().
+			AllowMethods(r.Methods...).AllowUsers(r.Users...).AllowGroups(r.Groups...).AllowRoles(r.Roles...).
+			AllowNetworks(r.Networks...).AllowDuring(r.Schedules...).
+			DenyMethods(r.DenyMethods...).DenyUsers(r.DenyUsers...).DenyGroups(r.DenyGroups...).
+			DenyNetworks(r.DenyNetworks...)
+		if r.NotBefore != nil {
+			permit = permit.AllowFrom(*r.NotBefore)
+		}
+		if r.NotAfter != nil {
+			permit = permit.AllowUntil(*r.NotAfter)
+		}
+		rt = rt.Permit(permit)
+		if len(r.Hosts) > 0 {
+			rt = rt.Host(r.Hosts...)
+		}
+		if r.Handler != "" {
+			h, ok := handlers[r.Handler]
+			if !ok {
+				return nil, &Error{Line: r.line, Err: fmt.Errorf("route %q: unknown handler %q", r.Path, r.Handler)}
+			}
+			rt = rt.Handler(namedHandler{name: r.Handler, Handler: h})
+		}
+		if r.Redirect != "" {
+			if rt, err = router.CompileRedirectTo(rt, r.Redirect, r.Code); err != nil {
+				return nil, &Error{Line: r.line, Err: err}
+			}
+		}
+		if r.Rewrite != "" {
+			rt = router.RewriteTo(rt, r.Rewrite)
+		}
+		t.Handle(rt)
+	}
+	return t, nil
+}
+
+// namedHandler is a handler Build took from its handlers, so Dump can name it again
+type namedHandler struct {
+	name string
+	http.Handler
+}
+
+// Load parses and builds the policy file at path, see Parse and Build
+func Load(path string, handlers map[string]http.Handler) (*router.Table, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Parse(data)
+	if err == nil {
+		var t *router.Table
+		if t, err = p.Build(handlers); err == nil {
+			return t, nil
+		}
+	}
+	if perr, ok := err.(*Error); ok {
+		perr.File = path
+	}
+	return nil, err
+}
+
+// Dump returns the policy for routes, which must have been made by this package or by
+// the router constructors. Middleware can't be represented and is dropped. Routes that
+// wouldn't load as they are served are an error: routes with conditions, as dropping them
+// would widen access, routes permitting no methods and routes with handlers Build didn't
+// set.
+func Dump(routes []router.Route) (Policy, error) {
+	p := Policy{Routes: []Route{}}
+	for _, rt := range routes {
+		kind, path, ok := router.KindOf(rt)
+		if !ok {
+			return Policy{}, fmt.Errorf("route %v can't be represented in a policy", rt)
+		}
+		if len(rt.Conditions()) > 0 {
+			return Policy{}, fmt.Errorf("route %q has conditions, which can't be represented in a policy", path)
+		}
+		if len(rt.HandledMethods()) > 0 {
+			return Policy{}, fmt.Errorf("route %q has method handlers, which can't be represented in a policy", path)
+		}
+		permitted := rt.Permitted()
+		if len(permitted.Methods()) == 0 {
+			return Policy{}, fmt.Errorf("route %q permits no methods", path)
+		}
+		r := Route{
+			Type:     kind,
+			Path:     path,
+			Hosts:    rt.Hosts(),
+			Methods:  permitted.Methods(),
+			Users:    permitted.Users(),
+			Groups:   permitted.Groups(),
+			Roles:    permitted.Roles(),
+			Networks: permitted.Networks(),
+			Rewrite:  router.RewriteOf(rt),
+
+			NotBefore: timeOrNil(permitted.NotBefore()),
+			NotAfter:  timeOrNil(permitted.NotAfter()),
+			Schedules: permitted.Schedules(),
+
+			DenyMethods:  permitted.DeniedMethods(),
+			DenyUsers:    permitted.DeniedUsers(),
+			DenyGroups:   permitted.DeniedGroups(),
+			DenyNetworks: permitted.DeniedNetworks(),
+		}
+		// routes without method handlers serve every method with their own handler
+		if h, ok := rt.HandlerFor(""); ok {
+			named, ok := h.(namedHandler)
+			if !ok {
+				return Policy{}, fmt.Errorf("route %q has a handler which can't be represented in a policy", path)
+			}
+			r.Handler = named.name
+		}
+		r.Redirect, r.Code = router.RedirectOf(rt)
+		p.Routes = append(p.Routes, r)
+	}
+	return p, nil
+}
+
+// DumpRoles returns the policy's roles for roles, in the order they were defined
+func DumpRoles(roles access.Roles) []Role {
+	out := []Role{}
+	for _, name := range roles.Names() {
+		r, _ := roles.Role(name)
+		out = append(out, Role{Name: r.Name, Inherits: r.Inherits, Methods: r.Methods, Users: r.Users, Groups: r.Groups})
+	}
+	return out
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// Marshal encodes the policy in the format Parse reads
+func (p Policy) Marshal() ([]byte, error) {
+	return json.MarshalIndent(p, "", "  ")
+}
@@ -0,0 +1,173 @@
+package policy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stuart-warren/serveit/access"
+	"github.com/stuart-warren/serveit/identity"
+	"github.com/stuart-warren/serveit/policy"
+	"github.com/stuart-warren/serveit/router"
+	"github.com/stuart-warren/serveit/rules"
+)
+
+const example = `{
+  "routes": [
+    {"type": "prefix", "path": "/access/", "methods": ["GET", "PUT"], "users": ["some.admin"], "notAfter": "2030-01-01T00:00:00Z", "schedules": ["Mon-Fri 08:00-18:00 Europe/London"]},
+    {"type": "prefix", "path": "/", "methods": ["GET", "HEAD"], "users": ["ALL"]},
+    {"type": "text", "path": "/metrics", "methods": ["GET"], "groups": ["monitoring"], "handler": "metrics"},
+    {"type": "regex", "path": "^/docs/v1/(.*)$", "methods": ["GET"], "users": ["ALL"], "rewrite": "/archive/docs/$1"},
+    {"type": "pattern", "path": "/users/{id}", "hosts": ["people.example.com"], "methods": ["GET"], "users": ["ANONYMOUS", "AUTHENTICATED"], "redirect": "/u/${id}", "code": 301}
+  ]
+}
+`
+
+func TestLoadPolicy(t *testing.T) {
+	p, err := policy.Parse([]byte(example))
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("metrics"))
+	})
+	table, err := p.Build(map[string]http.Handler{"metrics": metrics})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := router.NewRuleRouter(http.NotFoundHandler(), rules.All(rules.Method, rules.Any(rules.User, rules.Group)))
+	mux.Replace(table)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req = req.WithContext(identity.NewContext(req.Context(), identity.Identity{Email: "prometheus", Groups: []string{"monitoring"}}))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Body.String() != "metrics" {
+		t.Errorf("got %d %q", rec.Code, rec.Body.String())
+	}
+	if e, _ := mux.ExplainFor("PUT", "/access/x", "someone"); e.Allowed {
+		t.Errorf("got %+v", e)
+	}
+	if e, _ := mux.ExplainFor("GET", "http://people.example.com/users/bob", ""); e.Location != "/u/bob" {
+		t.Errorf("got %+v", e)
+	}
+
+	dumped, err := policy.Dump(mux.Routes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := dumped.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := policy.Parse(out)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if len(again.Routes) != 5 || again.Routes[4].Redirect != "/u/${id}" || again.Routes[0].Users[0] != "some.admin" ||
+		again.Routes[0].NotAfter == nil || len(again.Routes[0].Schedules) != 1 || again.Routes[2].Handler != "metrics" {
+		t.Errorf("got %s", out)
+	}
+	if _, err := again.Build(map[string]http.Handler{"metrics": metrics}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDumpErrors(t *testing.T) {
+	ro := access.BlankPermit().MethodRO().AllowUsers("ALL")
+	tests := []struct {
+		route router.Route
+		err   string
+	}{
+		{router.NewPrefixRoute("/"), `route "/" permits no methods`},
+		{router.NewPrefixRoute("/").Permit(access.BlankPermit()), `route "/" permits no methods`},
+		{router.NewPrefixRoute("/metrics").Handler(http.NotFoundHandler()).Permit(ro), `route "/metrics" has a handler which can't be represented in a policy`},
+		{router.NewTextRoute("/file").MethodHandler("GET", http.NotFoundHandler()).Permit(ro), `route "/file" has method handlers, which can't be represented in a policy`},
+	}
+	for _, tt := range tests {
+		if _, err := policy.Dump([]router.Route{tt.route}); err == nil || err.Error() != tt.err {
+			t.Errorf("%v: got %v", tt.route, err)
+		}
+	}
+}
+
+func TestPolicyErrors(t *testing.T) {
+	tests := []struct {
+		policy, err string
+	}{
+		{"{\n  \"routes\": [\n    {\"type\": \"prefix\", \"path\": \"/\", \"methods\": [\"GET\"], \"user\": [\"ALL\"]}\n  ]\n}", `line 3: json: unknown field "user"`},
+		{"{\n  \"routes\": [\n    {\"type\": \"prefix\", \"path\": \"/\", \"methods\": [\"GET\"]},\n    {\"type\": \"prefx\", \"path\": \"/\", \"methods\": [\"GET\"]}\n  ]\n}", `line 4: route "/" has unknown type "prefx"`},
+		{"{\n  \"routes\": [\n\n    {\"type\": \"regex\", \"path\": \"^/(\", \"methods\": [\"GET\"]}\n  ]\n}", "line 4: error parsing regexp: missing closing ): `^/(`"},
+		{"{\n  \"routes\": [\n    {\"type\": \"pattern\", \"path\": \"/{a}/{a}\", \"methods\": [\"GET\"]}\n  ]\n}", `line 3: pattern "/{a}/{a}": duplicate parameter "a"`},
+		{"{\n  \"routes\": [\n    {\"type\": \"text\", \"path\": \"/\", \"methods\": [\"get\"]}\n  ]\n}", `line 3: route "/": invalid method "get"`},
+		{"{\n  \"routes\": [\n    {\"type\": \"text\", \"path\": \"/\", \"methods\": []}\n  ]\n}", `line 3: route "/" permits no methods`},
+		{"{\n  \"routes\": [\n    {\"type\": \"text\", \"path\": \"/\", \"methods\": [\"GET\"], \"redirect\": \"/x\", \"code\": 200}\n  ]\n}", `line 3: route "/": invalid redirect code 200`},
+		{"{\n  \"routes\": [\n    {\"type\": \"text\", \"path\": \"/\", \"methods\": [\"GET\"], \"networks\": [\"10.0.0.0/33\"]}\n  ]\n}", `line 3: route "/": invalid CIDR address: 10.0.0.0/33`},
+		{"{\n  \"routes\": [\n    {\"type\": \"text\", \"path\": \"/\", \"methods\": \"GET\"}\n  ]\n}", `line 3: json: cannot unmarshal string into Go struct field Route.methods of type []string`},
+		{"{\n  \"routes\": [\n    {\"type\": \"text\", \"path\": \"/\",}\n  ]\n}", `line 3: invalid character '}' looking for beginning of object key string`},
+		{"{\n  \"rules\": []\n}", `line 2: unexpected field rules`},
+		{"{\n  \"routes\": [\n    {\"type\": \"text\", \"path\": \"/\", \"methods\": [\"GET\"], \"schedules\": [\"Mon-Fri 08:00-25:00\"]}\n  ]\n}", `line 3: route "/": invalid schedule "Mon-Fri 08:00-25:00": invalid time "25:00"`},
+		{"{\n  \"routes\": [\n    {\"type\": \"text\", \"path\": \"/\", \"methods\": [\"GET\"], \"notBefore\": \"2026-04-01T00:00:00Z\", \"notAfter\": \"2026-03-01T00:00:00Z\"}\n  ]\n}", `line 3: route "/": notBefore is not before notAfter`},
+		{"{\n  \"roles\": [\n    {\"name\": \"admin\", \"inherits\": [\"editor\"]}\n  ],\n  \"routes\": []\n}", `line 3: role "admin" inherits undefined role "editor"`},
+		{"{\n  \"roles\": [{\"name\": \"viewer\"}],\n  \"routes\": [\n    {\"type\": \"text\", \"path\": \"/\", \"methods\": [\"GET\"], \"roles\": [\"editor\"]}\n  ]\n}", `line 4: route "/": undefined role "editor"`},
+		{"{\"routes\": []}\n{}", `line 2: unexpected data after policy`},
+	}
+	for _, tt := range tests {
+		_, err := policy.Parse([]byte(tt.policy))
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("got %v, want %s", err, tt.err)
+		}
+	}
+}
+
+func TestLoadUnknownHandler(t *testing.T) {
+	p, err := policy.Parse([]byte(example))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Build(nil); err == nil || !strings.HasPrefix(err.Error(), "line 5: ") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestPolicyRoles(t *testing.T) {
+	const roled = `{
+  "roles": [
+    {"name": "viewer", "methods": ["GET"], "groups": ["staff"]},
+    {"name": "editor", "inherits": ["viewer"], "methods": ["PUT"], "users": ["ed@example.com"]}
+  ],
+  "routes": [
+    {"type": "prefix", "path": "/docs/", "methods": ["GET", "PUT"], "roles": ["viewer"]}
+  ]
+}`
+	p, err := policy.Parse([]byte(roled))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roles, err := p.AccessRoles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := p.Build(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := router.NewRuleRouter(http.NotFoundHandler(), rules.All(rules.Method, rules.Role(roles)))
+	mux.Replace(table)
+	if e, _ := mux.ExplainFor("PUT", "/docs/a", "ed@example.com"); !e.Allowed {
+		t.Errorf("got %+v", e)
+	}
+	dumped, err := policy.Dump(mux.Routes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dumped.Roles = policy.DumpRoles(roles)
+	again, err := dumped.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := policy.Parse(again); err != nil || !strings.Contains(string(again), `"inherits": [`) {
+		t.Errorf("got %v\n%s", err, again)
+	}
+}
@@ -0,0 +1,79 @@
+package router
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/stuart-warren/serveit/access"
+	"github.com/stuart-warren/serveit/identity"
+)
+
+// AuditRecord is an authorization decision made while serving a request
+type AuditRecord struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	Host   string    `json:"host"`
+	Path   string    `json:"path"`
+	Client string    `json:"client,omitempty"`
+	// the identity the decision was made for, empty for anonymous clients
+	Subject    string   `json:"subject,omitempty"`
+	Email      string   `json:"email,omitempty"`
+	Groups     []string `json:"groups,omitempty"`
+	AuthMethod string   `json:"authMethod,omitempty"`
+
+	Route     string           `json:"route"`
+	Hosts     []string         `json:"hosts,omitempty"`
+	Permitted access.Permitted `json:"permitted"`
+	Rewrites  []string         `json:"rewrites,omitempty"`
+	// Rule is the rule that made the final decision, Decisions are every decision made
+	Rule      string     `json:"rule"`
+	Decisions []Decision `json:"decisions"`
+	Allowed   bool       `json:"allowed"`
+	Status    int        `json:"status"`
+	Reason    string     `json:"reason"`
+}
+
+// Auditor records authorization decisions, it must be safe for concurrent use
+type Auditor interface {
+	Audit(record AuditRecord) error
+}
+
+// WithAuditor records every decision the router's rule makes in ServeHTTP to a, requests
+// the router rejects before running its rule are not recorded. Errors recording are
+// logged, they don't fail the request.
+func (o *Router) WithAuditor(a Auditor) *Router {
+	return o.configure(func(c *config) { c.auditor = a })
+}
+
+// audit records the decision in e, if the router's rule was run
+func (t *table) audit(r *http.Request, e Explanation) {
+	if t.auditor == nil || len(e.Decisions) == 0 {
+		return
+	}
+	record := AuditRecord{
+		Time:      time.Now().UTC(),
+		Method:    e.Method,
+		Host:      e.Host,
+		Path:      e.Path,
+		Client:    e.Client,
+		Hosts:     hosts(e.Route),
+		Permitted: e.Permitted,
+		Rewrites:  e.Rewrites,
+		Rule:      e.Decisions[len(e.Decisions)-1].Rule,
+		Decisions: e.Decisions,
+		Allowed:   e.Allowed,
+		Status:    e.Status,
+		Reason:    e.Reason,
+	}
+	if e.Route != nil {
+		record.Route = fmt.Sprintf("%v", e.Route)
+	}
+	if id, ok := identity.FromRequest(r); ok {
+		record.Subject, record.Email, record.Groups, record.AuthMethod = id.Subject, id.Email, id.Groups, id.Method
+	}
+	if err := t.auditor.Audit(record); err != nil {
+		log.Printf("audit: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package router
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// PathPolicy decides what happens to requests whose path is not in canonical form
+type PathPolicy int
+
+const (
+	// RedirectNonCanonical redirects to the canonical path, this is the default
+	RedirectNonCanonical PathPolicy = iota
+	// RejectNonCanonical responds 400 Bad Request
+	RejectNonCanonical
+)
+
+// WithPathPolicy sets how requests for non-canonical paths are handled, see canonicalPath
+func (o *Router) WithPathPolicy(policy PathPolicy) *Router {
+	return o.configure(func(c *config) { c.pathPolicy = policy })
+}
+
+// WithCaseInsensitivePaths matches request paths ignoring case, for handlers backed by
+// case-insensitive filesystems. Only the literal parts of routes made by this package
+// ignore case, values are captured as they appear in the request path.
+func (o *Router) WithCaseInsensitivePaths() *Router {
+	return o.configure(func(c *config) { c.foldCase = true })
+}
+
+// canonicalPath returns the form of the request path routes are matched against: dot
+// segments resolved, repeated slashes collapsed and a single consistent percent-encoding,
+// keeping any trailing slash. ok is false if the path can never be made canonical.
+func canonicalPath(u *url.URL) (canonical string, ok bool) {
+	p := u.Path
+	if strings.IndexByte(p, 0) >= 0 {
+		return "", false
+	}
+	if p == "" || p[0] != '/' {
+		p = "/" + p
+	}
+	clean := path.Clean(p)
+	if strings.HasSuffix(p, "/") && clean != "/" {
+		clean += "/"
+	}
+	return clean, true
+}
+
+// isCanonical reports whether the request URL is already in canonical form
+func isCanonical(u *url.URL, canonical string) bool {
+	if u.Path != canonical {
+		return false
+	}
+	// reject alternative encodings such as %2F or %61 for the same path
+	return u.RawPath == "" || u.RawPath == (&url.URL{Path: canonical}).EscapedPath()
+}
+
+func canonicalRedirect(r *http.Request, canonical string) (string, int) {
+	u := url.URL{Path: canonical, RawQuery: r.URL.RawQuery}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return u.String(), http.StatusMovedPermanently
+	}
+	return u.String(), http.StatusPermanentRedirect
+}
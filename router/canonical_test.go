@@ -0,0 +1,119 @@
+package router_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stuart-warren/serveit/access"
+	"github.com/stuart-warren/serveit/router"
+)
+
+func fileRouter(t *testing.T) (*router.Router, func()) {
+	dir, err := ioutil.TempDir("", "serveit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Mkdir(filepath.Join(dir, "access"), 0755)
+	os.Mkdir(filepath.Join(dir, "public"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "access", "secret.txt"), []byte("secret"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "public", "index.txt"), []byte("public"), 0644)
+
+	mux := router.NewRouter(http.FileServer(http.Dir(dir)), checkUser)
+	mux.Handle(router.NewPrefixRoute("/access/").Permit(access.BlankPermit().MethodRW().AllowUsers("some.admin")))
+	mux.Handle(router.NewPrefixRoute("/").Permit(access.BlankPermit().MethodRO().AllowUsers("ALL")))
+	return mux, func() { os.RemoveAll(dir) }
+}
+
+var bypasses = []string{
+	"//access/secret.txt",
+	"/./access/secret.txt",
+	"/public/../access/secret.txt",
+	"/public/%2e%2e/access/secret.txt",
+	"/%2e/access/secret.txt",
+	"/%61ccess/secret.txt",
+	"/access%2fsecret.txt",
+	"/public/..%2faccess/secret.txt",
+	"///access///secret.txt",
+}
+
+func TestCanonicalPathRedirects(t *testing.T) {
+	mux, cleanup := fileRouter(t)
+	defer cleanup()
+
+	for _, target := range bypasses {
+		rec := serve(mux, "GET", target)
+		if rec.Code != http.StatusMovedPermanently {
+			t.Errorf("%s: got %d %q", target, rec.Code, rec.Body.String())
+			continue
+		}
+		location := rec.Header().Get("Location")
+		if rec := serve(mux, "GET", location); rec.Code != http.StatusForbidden {
+			t.Errorf("%s: redirected to %s, got %d", target, location, rec.Code)
+		}
+	}
+	if rec := serve(mux, "GET", "/public/index.txt?x=1"); rec.Code != http.StatusOK || rec.Body.String() != "public" {
+		t.Errorf("got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := serve(mux, "PUT", "//access/secret.txt?x=1"); rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != "/access/secret.txt?x=1" {
+		t.Errorf("got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestCanonicalPathRejects(t *testing.T) {
+	mux, cleanup := fileRouter(t)
+	defer cleanup()
+	mux.WithPathPolicy(router.RejectNonCanonical)
+
+	for _, target := range append(bypasses, "/access/secret.txt%00") {
+		if rec := serve(mux, "GET", target); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d %q", target, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestCaseInsensitivePaths(t *testing.T) {
+	mux, cleanup := fileRouter(t)
+	defer cleanup()
+	mux.WithCaseInsensitivePaths()
+
+	for _, target := range []string{"/Access/secret.txt", "/ACCESS/secret.txt", "/aCCess/"} {
+		req := httptest.NewRequest("GET", target, nil)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s: got %d", target, rec.Code)
+		}
+	}
+}
+
+func TestCaseInsensitiveCaptures(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path + " " + router.Param(r, "id")))
+	})
+	mux := router.NewRouter(echo, allowAll).WithCaseInsensitivePaths()
+	mux.Handle(router.NewPatternRoute("/users/{id}/Files/"))
+	mux.Handle(router.NewGlobRoute("/docs/*.PDF"))
+	mux.Handle(router.NewRegexRoute(regexp.MustCompile(`^/items/(?P<id>[a-z]+)$`)))
+	mux.Handle(router.RedirectTo(router.NewPatternRoute("/u/{id}"), "/users/${id}/files/", http.StatusFound))
+
+	tests := []struct {
+		path, body string
+	}{
+		{"/USERS/Alice/files/x", "/USERS/Alice/files/x Alice"},
+		{"/Docs/Report.pdf", "/Docs/Report.pdf "},
+		{"/Items/Bob", "/Items/Bob Bob"},
+	}
+	for _, tt := range tests {
+		if rec := serve(mux, "GET", tt.path); rec.Code != http.StatusOK || rec.Body.String() != tt.body {
+			t.Errorf("%s: got %d %q", tt.path, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := serve(mux, "GET", "/U/Alice"); rec.Header().Get("Location") != "/users/Alice/files/" {
+		t.Errorf("got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
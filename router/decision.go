@@ -0,0 +1,68 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Decision is the outcome of a Rule
+type Decision struct {
+	Rule    string `json:"rule"`
+	Allowed bool   `json:"allowed"`
+	// Abstained decisions express no opinion, the router denies a request if its rule abstains
+	Abstained bool   `json:"abstained,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	// Steps are the decisions of the rules a combined rule evaluated
+	Steps []Decision `json:"steps,omitempty"`
+}
+
+// Rule decides whether a request may be served by route
+type Rule func(w http.ResponseWriter, r *http.Request, route Route) Decision
+
+// Allow returns a decision by rule to allow the request for reason
+func Allow(rule, reason string) Decision {
+	return Decision{Rule: rule, Allowed: true, Reason: reason}
+}
+
+// Deny returns a decision by rule to deny the request for reason
+func Deny(rule, reason string) Decision {
+	return Decision{Rule: rule, Reason: reason}
+}
+
+// Abstain returns a decision by rule to express no opinion for reason
+func Abstain(rule, reason string) Decision {
+	return Decision{Rule: rule, Abstained: true, Reason: reason}
+}
+
+// BoolRule adapts a rule reporting only allowed or not to a Rule named name
+func BoolRule(name string, authorized func(w http.ResponseWriter, r *http.Request, route Route) bool) Rule {
+	return func(w http.ResponseWriter, r *http.Request, route Route) Decision {
+		if authorized(w, r, route) {
+			return Allow(name, "allowed")
+		}
+		return Deny(name, "denied")
+	}
+}
+
+// String describes the decision and the steps leading to it
+func (d Decision) String() string {
+	outcome := "denied"
+	switch {
+	case d.Abstained:
+		outcome = "abstained"
+	case d.Allowed:
+		outcome = "allowed"
+	}
+	s := d.Rule + " " + outcome
+	if d.Reason != "" {
+		s += ": " + d.Reason
+	}
+	if len(d.Steps) > 0 {
+		steps := make([]string, len(d.Steps))
+		for i, step := range d.Steps {
+			steps[i] = step.String()
+		}
+		s += " [" + strings.Join(steps, "; ") + "]"
+	}
+	return s
+}
@@ -0,0 +1,43 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/stuart-warren/serveit/access"
+	"github.com/stuart-warren/serveit/identity"
+	"github.com/stuart-warren/serveit/network"
+)
+
+// denyRule denies requests using a method, or from a user, member of a group or network,
+// the route's permit denies, abstaining otherwise. Routers apply it before their own rule,
+// so denied entries override anything the rule allows. Unknown clients are denied by any
+// network the permit denies.
+func denyRule(w http.ResponseWriter, r *http.Request, route Route) Decision {
+	p := route.Permitted()
+	for _, m := range p.DeniedMethods() {
+		// HEAD is served by the GET handler, so denying GET denies it too
+		if m == "ALL" || m == r.Method || m == http.MethodGet && r.Method == http.MethodHead {
+			return Deny("deny", r.Method+" denied")
+		}
+	}
+	if denied := p.ParsedDeniedNetworks(); len(denied) > 0 {
+		if in, reason, ok := network.ClientIn(r, denied); in || !ok {
+			return Deny("deny", reason+" denied")
+		}
+	}
+	id, ok := identity.FromRequest(r)
+	for _, u := range p.DeniedUsers() {
+		if access.MatchUser(u, ok, id.Email, id.Subject) {
+			return Deny("deny", fmt.Sprintf("user %q denied", u))
+		}
+	}
+	if ok {
+		for _, g := range p.DeniedGroups() {
+			if id.InGroup(g) {
+				return Deny("deny", fmt.Sprintf("group %q denied", g))
+			}
+		}
+	}
+	return Abstain("deny", "nothing denied")
+}
@@ -0,0 +1,177 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrorRenderer writes the response for an error status produced by the router itself,
+// rather than by a route's handler
+type ErrorRenderer func(w http.ResponseWriter, r *http.Request, status int)
+
+// WithErrorRenderer sets how the router renders 400, 403, 404 and 405 responses
+func (o *Router) WithErrorRenderer(render ErrorRenderer) *Router {
+	return o.configure(func(c *config) { c.renderError = render })
+}
+
+// WithForbiddenAsNotFound responds 404 rather than 403 when a rule denies a request, and
+// only reports 405 to clients the rule allows, so clients can't discover which protected
+// paths exist
+func (o *Router) WithForbiddenAsNotFound() *Router {
+	return o.configure(func(c *config) { c.hideForbidden = true })
+}
+
+var plainErrors = map[int]string{
+	http.StatusBadRequest:       "400 bad request",
+	http.StatusForbidden:        "403 Forbidden",
+	http.StatusNotFound:         "404 page not found",
+	http.StatusMethodNotAllowed: "405 method not allowed",
+}
+
+// PlainTextErrors renders errors as short plain text messages, this is the default
+func PlainTextErrors(w http.ResponseWriter, r *http.Request, status int) {
+	msg, ok := plainErrors[status]
+	if !ok {
+		msg = fmt.Sprintf("%d %s", status, http.StatusText(status))
+	}
+	http.Error(w, msg, status)
+}
+
+// ProblemJSONErrors renders errors as RFC 7807 application/problem+json documents
+func ProblemJSONErrors(w http.ResponseWriter, r *http.Request, status int) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Type     string `json:"type"`
+		Title    string `json:"title"`
+		Status   int    `json:"status"`
+		Instance string `json:"instance"`
+	}{"about:blank", http.StatusText(status), status, r.URL.Path})
+}
+
+// ErrorPage is the data passed to templates loaded by HTMLTemplateErrors
+type ErrorPage struct {
+	Status     int
+	StatusText string
+	Path       string
+}
+
+// HTMLTemplateErrors loads error page templates from dir, named for their status such
+// as 404.html, with error.html used for any status without its own page. Statuses without
+// a template are rendered with PlainTextErrors.
+func HTMLTemplateErrors(dir string) (ErrorRenderer, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+	pages := map[string]*template.Template{}
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(filepath.Base(f), ".html")
+		t, err := template.New(name).Parse(string(b))
+		if err != nil {
+			return nil, err
+		}
+		pages[name] = t
+	}
+	return func(w http.ResponseWriter, r *http.Request, status int) {
+		t, ok := pages[strconv.Itoa(status)]
+		if !ok {
+			t, ok = pages["error"]
+		}
+		if !ok {
+			PlainTextErrors(w, r, status)
+			return
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, ErrorPage{status, http.StatusText(status), r.URL.Path}); err != nil {
+			PlainTextErrors(w, r, status)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(status)
+		buf.WriteTo(w)
+	}, nil
+}
+
+// NegotiatedErrors picks a renderer from renderers, keyed by media type, using the
+// request's Accept header, falling back to fallback when nothing offered is acceptable
+func NegotiatedErrors(renderers map[string]ErrorRenderer, fallback ErrorRenderer) ErrorRenderer {
+	offers := make([]string, 0, len(renderers))
+	for t := range renderers {
+		offers = append(offers, t)
+	}
+	// deterministic choice between equally acceptable offers
+	sort.Strings(offers)
+	return func(w http.ResponseWriter, r *http.Request, status int) {
+		if t := negotiate(r.Header.Get("Accept"), offers); t != "" {
+			renderers[t](w, r, status)
+			return
+		}
+		fallback(w, r, status)
+	}
+}
+
+// negotiate returns the offer with the highest quality in accept, preferring more
+// specific media ranges, or "" if none is acceptable
+func negotiate(accept string, offers []string) string {
+	best, bestQ, bestSpecificity := "", 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaRange := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaRange == "" {
+			continue
+		}
+		q := 1.0
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if v, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		specificity := 2
+		if mediaRange == "*/*" {
+			specificity = 0
+		} else if strings.HasSuffix(mediaRange, "/*") {
+			specificity = 1
+		}
+		for _, offer := range offers {
+			if !mediaMatches(mediaRange, offer) {
+				continue
+			}
+			if q > bestQ || q == bestQ && specificity > bestSpecificity {
+				best, bestQ, bestSpecificity = offer, q, specificity
+			}
+		}
+	}
+	return best
+}
+
+func mediaMatches(mediaRange, offer string) bool {
+	switch {
+	case mediaRange == "*/*":
+		return true
+	case strings.HasSuffix(mediaRange, "/*"):
+		return strings.HasPrefix(offer, mediaRange[:len(mediaRange)-1])
+	default:
+		return mediaRange == offer
+	}
+}
@@ -0,0 +1,79 @@
+package router_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stuart-warren/serveit/access"
+	"github.com/stuart-warren/serveit/router"
+)
+
+func TestErrorRenderers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "serveit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "404.html"), []byte(`<h1>Not here: {{.Path}}</h1>`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "error.html"), []byte(`<h1>{{.Status}} {{.StatusText}}</h1>`), 0644)
+	html, err := router.HTMLTemplateErrors(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := router.NewRouter(body("ok"), checkUser).WithErrorRenderer(router.NegotiatedErrors(map[string]router.ErrorRenderer{
+		"text/html":                html,
+		"application/problem+json": router.ProblemJSONErrors,
+		"application/json":         router.ProblemJSONErrors,
+	}, router.PlainTextErrors))
+	mux.Handle(router.NewPrefixRoute("/access/").Permit(access.BlankPermit().MethodRW().AllowUsers("some.admin")))
+
+	tests := []struct {
+		path, accept, contentType, body string
+		code                            int
+	}{
+		{"/missing", "text/html,application/xhtml+xml,*/*;q=0.8", "text/html; charset=utf-8", "<h1>Not here: /missing</h1>", 404},
+		{"/access/x", "text/html", "text/html; charset=utf-8", "<h1>403 Forbidden</h1>", 403},
+		{"/access/x", "application/json", "application/problem+json", `{"type":"about:blank","title":"Forbidden","status":403,"instance":"/access/x"}` + "\n", 403},
+		{"/access/x", "text/html;q=0.5, application/*", "application/problem+json", "", 403},
+		{"/access/x", "image/png", "text/plain; charset=utf-8", "403 Forbidden\n", 403},
+		{"/access/x", "", "text/plain; charset=utf-8", "403 Forbidden\n", 403},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != tt.code || rec.Header().Get("Content-Type") != tt.contentType || tt.body != "" && rec.Body.String() != tt.body {
+			t.Errorf("%s %q: got %d %q %q", tt.path, tt.accept, rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+		}
+	}
+}
+
+func TestForbiddenAsNotFound(t *testing.T) {
+	mux := router.NewRouter(body("ok"), checkUser).WithForbiddenAsNotFound()
+	mux.Handle(router.NewPrefixRoute("/access/").Permit(access.BlankPermit().MethodRW().AllowUsers("some.admin")))
+	protected, missing := serve(mux, "GET", "/access/x"), serve(mux, "GET", "/missing")
+	if protected.Code != http.StatusNotFound || protected.Body.String() != missing.Body.String() {
+		t.Errorf("got %d %q", protected.Code, protected.Body.String())
+	}
+	if !strings.HasPrefix(missing.Body.String(), "404") {
+		t.Errorf("got %q", missing.Body.String())
+	}
+
+	mux.Handle(router.NewPrefixRoute("/secret").MethodHandler(http.MethodGet, body("secret")).Permit(access.BlankPermit().MethodRW().AllowUsers("some.admin")))
+	if w := serve(mux, "POST", "/secret"); w.Code != http.StatusNotFound || w.Header().Get("Allow") != "" || w.Body.String() != missing.Body.String() {
+		t.Errorf("got %d %q allow %q", w.Code, w.Body.String(), w.Header().Get("Allow"))
+	}
+	r := as(httptest.NewRequest("POST", "/secret", nil), "some.admin")
+	if w := serveRequest(mux, r); w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("got %d allow %q", w.Code, w.Header().Get("Allow"))
+	}
+}
@@ -0,0 +1,126 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/stuart-warren/serveit/access"
+	"github.com/stuart-warren/serveit/identity"
+)
+
+// Explanation describes how the router handles a request
+type Explanation struct {
+	Method string `json:"method"`
+	Host   string `json:"host"`
+	Path   string `json:"path"`
+	User   string `json:"user"`
+	// Client is the client address rules see, see WithTrustedProxies
+	Client string `json:"client,omitempty"`
+	// Route is the matched route, nil if none matched
+	Route     Route            `json:"-"`
+	Permitted access.Permitted `json:"permitted"`
+	Params    Params           `json:"params,omitempty"`
+	// Rewrites are the paths the request was rewritten to, in order
+	Rewrites []string `json:"rewrites,omitempty"`
+	// Decisions are those of the router's rule, one for each route the request was
+	// authorized against
+	Decisions []Decision `json:"decisions,omitempty"`
+	Allowed   bool       `json:"allowed"`
+	// Status is the response status the router produces, 200 when a handler is run
+	Status   int    `json:"status"`
+	Allow    string `json:"allow,omitempty"`
+	Location string `json:"location,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+func (e Explanation) MarshalJSON() ([]byte, error) {
+	type explanation Explanation
+	route := ""
+	if e.Route != nil {
+		route = fmt.Sprintf("%v", e.Route)
+	}
+	return json.Marshal(struct {
+		explanation
+		Route string   `json:"route"`
+		Hosts []string `json:"hosts,omitempty"`
+	}{explanation(e), route, hosts(e.Route)})
+}
+
+func hosts(r Route) []string {
+	if r == nil {
+		return nil
+	}
+	return r.Hosts()
+}
+
+// Explain reports which route r matches, its permits and the rules evaluated,
+// without running any handler
+func (o *Router) Explain(r *http.Request) Explanation {
+	e, _, _ := o.decide(o.load(), discard{header: http.Header{}}, r)
+	return e
+}
+
+// ExplainFor explains a synthetic request for target, a path or absolute URL, made by user,
+// an email address, or anonymously if user is empty
+func (o *Router) ExplainFor(method, target, user string) (Explanation, error) {
+	r, err := http.NewRequest(method, target, nil)
+	if err != nil {
+		return Explanation{}, err
+	}
+	if r.Host == "" {
+		r.Host = r.URL.Host
+	}
+	if user != "" {
+		r = r.WithContext(identity.NewContext(r.Context(), identity.Identity{Email: user, Method: "explain"}))
+	}
+	return o.Explain(r), nil
+}
+
+// ExplainHandler serves explanations as JSON for the method, path, host and user query
+// parameters. Guard it by registering it on a route with its own permit.
+func (o *Router) ExplainHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		method, path, host := q.Get("method"), q.Get("path"), q.Get("host")
+		if method == "" {
+			method = http.MethodGet
+		}
+		if host == "" {
+			host = r.Host
+		}
+		if path == "" {
+			http.Error(w, "missing path parameter", http.StatusBadRequest)
+			return
+		}
+		if !strings.HasPrefix(path, "/") {
+			http.Error(w, "path parameter must begin with /", http.StatusBadRequest)
+			return
+		}
+		u := url.URL{Scheme: "http", Host: host, Path: path}
+		e, err := o.ExplainFor(method, u.String(), q.Get("user"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(e)
+	})
+}
+
+// discard is a ResponseWriter for rules run while explaining
+type discard struct {
+	header http.Header
+}
+
+func (d discard) Header() http.Header {
+	return d.header
+}
+
+func (d discard) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (d discard) WriteHeader(int) {}
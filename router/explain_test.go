@@ -0,0 +1,71 @@
+package router_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stuart-warren/serveit/access"
+	"github.com/stuart-warren/serveit/identity"
+	"github.com/stuart-warren/serveit/router"
+)
+
+func checkUser(w http.ResponseWriter, r *http.Request, route router.Route) bool {
+	id, _ := identity.FromRequest(r)
+	for _, u := range route.Permitted().Users() {
+		if u == "ALL" || u == id.Email {
+			return true
+		}
+	}
+	return false
+}
+
+func as(r *http.Request, email string) *http.Request {
+	return r.WithContext(identity.NewContext(r.Context(), identity.Identity{Email: email}))
+}
+
+func TestExplain(t *testing.T) {
+	mux := router.NewRouter(body("static"), checkUser)
+	mux.Handle(router.NewPrefixRoute("/access/").Permit(access.BlankPermit().MethodRW().AllowUsers("some.admin")))
+	mux.Handle(router.NewPrefixRoute("/").Permit(access.BlankPermit().MethodRO().AllowUsers("ALL")))
+	mux.Handle(router.NewTextRoute("/debug/explain").Handler(mux.ExplainHandler()).Permit(access.BlankPermit().MethodRO().AllowUsers("some.admin")))
+
+	e, err := mux.ExplainFor("GET", "/access/secret", "someone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Status != http.StatusForbidden || e.Allowed || e.Route == nil || e.Route.(interface{ String() string }).String() != "/access/" {
+		t.Errorf("got %+v", e)
+	}
+	e, _ = mux.ExplainFor("GET", "/access/secret", "some.admin")
+	if e.Status != http.StatusOK || !e.Allowed {
+		t.Errorf("got %+v", e)
+	}
+
+	req := httptest.NewRequest("GET", "/debug/explain?path=/access/secret&user=someone", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("explain endpoint not guarded, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, as(req, "some.admin"))
+	var got struct {
+		Route     string `json:"route"`
+		Status    int    `json:"status"`
+		Permitted struct {
+			Users []string `json:"users"`
+		} `json:"permitted"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("%v: %s", err, rec.Body.String())
+	}
+	if got.Route != "/access/" || got.Status != http.StatusForbidden || len(got.Permitted.Users) != 1 {
+		t.Errorf("got %s", rec.Body.String())
+	}
+	req = as(httptest.NewRequest("GET", "/debug/explain?path=secret", nil), "some.admin")
+	if rec := serveRequest(mux, req); rec.Code != http.StatusBadRequest {
+		t.Errorf("got %d %s", rec.Code, rec.Body.String())
+	}
+}
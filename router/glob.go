@@ -0,0 +1,274 @@
+package router
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+type globMatcher struct {
+	pattern string
+	// alternatives holds one compiled glob per expansion of any {a,b} groups
+	alternatives [][]globSegment
+	fold         bool
+}
+
+type globSegment struct {
+	// doubleStar segments match zero or more whole path segments
+	doubleStar bool
+	tokens     []globToken
+}
+
+type globToken struct {
+	kind    byte
+	literal string
+}
+
+const (
+	globLiteral  = 'l'
+	globStar     = '*'
+	globQuestion = '?'
+)
+
+// NewGlobRoute returns a route matching a glob such as /reports/**/*.pdf or /*.{css,js}
+//
+// * matches any run of characters within a path segment, ? matches a single character,
+// a ** segment matches zero or more whole segments, {a,b} matches either alternative and
+// \ escapes the next character. The whole path must match. It panics if the glob is invalid.
+func NewGlobRoute(glob string) Route {
+	r, err := CompileGlobRoute(glob)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// CompileGlobRoute is like NewGlobRoute but returns an error for an invalid glob
+func CompileGlobRoute(glob string) (Route, error) {
+	m, err := compileGlob(glob)
+	if err != nil {
+		return nil, err
+	}
+	return newRoute(m), nil
+}
+
+func compileGlob(glob string) (globMatcher, error) {
+	m := globMatcher{pattern: glob}
+	if !strings.HasPrefix(glob, "/") {
+		return m, fmt.Errorf("glob %q must begin with /", glob)
+	}
+	expanded, err := expandBraces(glob)
+	if err != nil {
+		return m, fmt.Errorf("glob %q: %v", glob, err)
+	}
+	for _, e := range expanded {
+		segments := []globSegment{}
+		for _, part := range splitGlob(e[1:]) {
+			if part == "**" {
+				segments = append(segments, globSegment{doubleStar: true})
+				continue
+			}
+			segments = append(segments, globSegment{tokens: tokenise(part)})
+		}
+		m.alternatives = append(m.alternatives, segments)
+	}
+	return m, nil
+}
+
+// expandBraces returns every expansion of the {a,b} groups in glob, leaving escapes in place
+func expandBraces(glob string) ([]string, error) {
+	open := -1
+	depth := 0
+	commas := []int{}
+	for i := 0; i < len(glob); i++ {
+		switch glob[i] {
+		case '\\':
+			i++
+		case '{':
+			if depth == 0 {
+				open = i
+			}
+			depth++
+		case ',':
+			if depth == 1 {
+				commas = append(commas, i)
+			}
+		case '}':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unexpected }")
+			}
+			if depth > 0 {
+				continue
+			}
+			head, tail := glob[:open], glob[i+1:]
+			starts := append([]int{open}, commas...)
+			ends := append(commas, i)
+			expanded := []string{}
+			for j := range starts {
+				alternatives, err := expandBraces(head + glob[starts[j]+1:ends[j]] + tail)
+				if err != nil {
+					return nil, err
+				}
+				expanded = append(expanded, alternatives...)
+			}
+			return expanded, nil
+		}
+	}
+	if depth > 0 {
+		return nil, fmt.Errorf("unterminated {")
+	}
+	return []string{glob}, nil
+}
+
+// splitGlob splits on unescaped slashes
+func splitGlob(glob string) []string {
+	parts := []string{}
+	start := 0
+	for i := 0; i < len(glob); i++ {
+		switch glob[i] {
+		case '\\':
+			i++
+		case '/':
+			parts = append(parts, glob[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, glob[start:])
+}
+
+func tokenise(part string) []globToken {
+	tokens := []globToken{}
+	literal := ""
+	flush := func() {
+		if literal != "" {
+			tokens = append(tokens, globToken{kind: globLiteral, literal: literal})
+			literal = ""
+		}
+	}
+	for i := 0; i < len(part); i++ {
+		switch c := part[i]; c {
+		case '\\':
+			if i+1 < len(part) {
+				i++
+				literal += part[i : i+1]
+			}
+		case '*':
+			flush()
+			// runs of * are a single *
+			if len(tokens) == 0 || tokens[len(tokens)-1].kind != globStar {
+				tokens = append(tokens, globToken{kind: globStar})
+			}
+		case '?':
+			flush()
+			tokens = append(tokens, globToken{kind: globQuestion})
+		default:
+			literal += part[i : i+1]
+		}
+	}
+	flush()
+	return tokens
+}
+
+func (g globMatcher) match(path string) (Params, bool) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, false
+	}
+	for _, segments := range g.alternatives {
+		if matchSegments(segments, path[1:], g.fold) {
+			return nil, true
+		}
+	}
+	return nil, false
+}
+
+func (g globMatcher) foldCase() pathMatcher {
+	g.fold = true
+	return g
+}
+
+// matchSegments matches path, the remainder after a slash, against segments, ignoring the
+// case of literals if fold is set
+func matchSegments(segments []globSegment, path string, fold bool) bool {
+	for i, s := range segments {
+		if s.doubleStar {
+			if i == len(segments)-1 {
+				return true
+			}
+			for {
+				if matchSegments(segments[i+1:], path, fold) {
+					return true
+				}
+				j := strings.IndexByte(path, '/')
+				if j < 0 {
+					return false
+				}
+				path = path[j+1:]
+			}
+		}
+		part := path
+		j := strings.IndexByte(path, '/')
+		if j >= 0 {
+			part = path[:j]
+		}
+		if !s.match(part, fold) {
+			return false
+		}
+		if i == len(segments)-1 || j < 0 {
+			return i == len(segments)-1 && j < 0
+		}
+		path = path[j+1:]
+	}
+	return false
+}
+
+// match matches a single path segment, backtracking to the last * on a mismatch
+func (s globSegment) match(part string, fold bool) bool {
+	ti, pi := 0, 0
+	starT, starP := -1, 0
+	for {
+		if ti < len(s.tokens) {
+			t := s.tokens[ti]
+			switch t.kind {
+			case globStar:
+				starT, starP = ti, pi
+				ti++
+				continue
+			case globQuestion:
+				if pi < len(part) {
+					_, n := utf8.DecodeRuneInString(part[pi:])
+					pi += n
+					ti++
+					continue
+				}
+			case globLiteral:
+				if rest := part[pi:]; strings.HasPrefix(rest, t.literal) ||
+					fold && len(rest) >= len(t.literal) && strings.EqualFold(rest[:len(t.literal)], t.literal) {
+					pi += len(t.literal)
+					ti++
+					continue
+				}
+			}
+		} else if pi == len(part) {
+			return true
+		}
+		if starT < 0 || starP >= len(part) {
+			return false
+		}
+		_, n := utf8.DecodeRuneInString(part[starP:])
+		starP += n
+		pi, ti = starP, starT+1
+	}
+}
+
+// static returns the literal part of the glob before any wildcard or group
+func (g globMatcher) static() string {
+	if i := strings.IndexAny(g.pattern, `*?{\`); i >= 0 {
+		return g.pattern[:i]
+	}
+	return g.pattern
+}
+
+func (g globMatcher) String() string {
+	return g.pattern
+}
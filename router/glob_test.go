@@ -0,0 +1,72 @@
+package router_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stuart-warren/serveit/router"
+)
+
+func TestGlobRoute(t *testing.T) {
+	tests := []struct {
+		glob, path string
+		match      bool
+	}{
+		{"/reports/**/*.pdf", "/reports/a.pdf", true},
+		{"/reports/**/*.pdf", "/reports/2019/q1/a.pdf", true},
+		{"/reports/**/*.pdf", "/reports/2019/q1/a.pdf.txt", false},
+		{"/reports/**/*.pdf", "/other/reports/a.pdf", false},
+		{"/reports/**", "/reports/", true},
+		{"/reports/**", "/reports/a/b", true},
+		{"/reports/**", "/reports", false},
+		{"/*.{css,js}", "/app.css", true},
+		{"/*.{css,js}", "/app.js", true},
+		{"/*.{css,js}", "/app.json", false},
+		{"/*.{css,js}", "/static/app.js", false},
+		{"/img/{small,large}/*.{png,jp{e,}g}", "/img/large/x.jpg", true},
+		{"/img/{small,large}/*.{png,jp{e,}g}", "/img/large/x.jpeg", true},
+		{"/img/{small,large}/*.{png,jp{e,}g}", "/img/medium/x.png", false},
+		{"/file?.txt", "/file1.txt", true},
+		{"/file?.txt", "/file12.txt", false},
+		{"/a*b*c", "/abxbc", true},
+		{"/a*b*c", "/abxbcx", false},
+		{`/literal\*`, "/literal*", true},
+		{`/literal\*`, "/literalx", false},
+		{"/", "/", true},
+		{"/", "/x", false},
+	}
+	for _, tt := range tests {
+		if got := router.NewGlobRoute(tt.glob).Match(tt.path); got != tt.match {
+			t.Errorf("%s %s: got %v", tt.glob, tt.path, got)
+		}
+	}
+}
+
+func TestGlobRouteSpecificity(t *testing.T) {
+	mux := router.NewRouter(nil, allowAll)
+	mux.Handle(router.NewPrefixRoute("/").Handler(body("root")))
+	mux.Handle(router.NewPrefixRoute("/reports/").Handler(body("reports")))
+	mux.Handle(router.NewGlobRoute("/reports/**/*.pdf").Handler(body("pdf")))
+	if rec := serve(mux, "GET", "/reports/2019/a.pdf"); rec.Body.String() != "pdf" {
+		t.Errorf("got %q", rec.Body.String())
+	}
+	if rec := serve(mux, "GET", "/reports/2019/a.txt"); rec.Body.String() != "reports" {
+		t.Errorf("got %q", rec.Body.String())
+	}
+}
+
+const benchPath = "/reports/2019/q1/finance/summary.pdf"
+
+func BenchmarkGlob(b *testing.B) {
+	route := router.NewGlobRoute("/reports/**/*.pdf")
+	for i := 0; i < b.N; i++ {
+		route.Match(benchPath)
+	}
+}
+
+func BenchmarkGlobRegexp(b *testing.B) {
+	route := router.NewRegexRoute(regexp.MustCompile(`^/reports/(?:[^/]*/)*[^/]*\.pdf$`))
+	for i := 0; i < b.N; i++ {
+		route.Match(benchPath)
+	}
+}
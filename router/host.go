@@ -0,0 +1,14 @@
+package router
+
+import (
+	"net"
+	"strings"
+)
+
+// canonicalHost lower cases host and strips any port and trailing dot
+func canonicalHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
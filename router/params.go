@@ -0,0 +1,26 @@
+package router
+
+import (
+	"context"
+	"net/http"
+)
+
+// Params holds values captured from the request path by the matched route
+type Params map[string]string
+
+type paramsKey struct{}
+
+func withParams(ctx context.Context, params Params) context.Context {
+	return context.WithValue(ctx, paramsKey{}, params)
+}
+
+// ParamsFromContext returns the values captured by the matched route, if any
+func ParamsFromContext(ctx context.Context) Params {
+	params, _ := ctx.Value(paramsKey{}).(Params)
+	return params
+}
+
+// Param returns the named value captured from the request path, or "" if there isn't one
+func Param(r *http.Request, name string) string {
+	return ParamsFromContext(r.Context())[name]
+}
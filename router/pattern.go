@@ -0,0 +1,156 @@
+package router
+
+import (
+	"fmt"
+	"strings"
+)
+
+type segment struct {
+	literal string
+	param   string
+	rest    bool
+}
+
+type patternMatcher struct {
+	pattern  string
+	segments []segment
+	// subtree is set by a trailing slash, the pattern then matches anything beneath it
+	subtree bool
+	fold    bool
+}
+
+// NewPatternRoute returns a route matching a path template such as /users/{id}/files/{path...}
+//
+// {name} matches a single non-empty path segment and {name...} matches the remainder of
+// the path and must come last. A trailing slash matches everything beneath the template,
+// as http.ServeMux does. Captured values are available from Param in handlers and rules.
+// It panics if the template is invalid.
+func NewPatternRoute(pattern string) Route {
+	r, err := CompilePatternRoute(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// CompilePatternRoute is like NewPatternRoute but returns an error for an invalid template
+func CompilePatternRoute(pattern string) (Route, error) {
+	m, err := parsePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return newRoute(m), nil
+}
+
+func parsePattern(pattern string) (patternMatcher, error) {
+	m := patternMatcher{pattern: pattern}
+	if !strings.HasPrefix(pattern, "/") {
+		return m, fmt.Errorf("pattern %q must begin with /", pattern)
+	}
+	path := pattern[1:]
+	if strings.HasSuffix(pattern, "/") {
+		m.subtree = true
+		path = strings.TrimSuffix(path, "/")
+	}
+	if path == "" {
+		return m, nil
+	}
+	seen := map[string]bool{}
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if !strings.HasPrefix(part, "{") {
+			if strings.ContainsAny(part, "{}") {
+				return m, fmt.Errorf("pattern %q: segment %q must be a literal or a whole {param}", pattern, part)
+			}
+			m.segments = append(m.segments, segment{literal: part})
+			continue
+		}
+		if !strings.HasSuffix(part, "}") {
+			return m, fmt.Errorf("pattern %q: unterminated parameter in %q", pattern, part)
+		}
+		name := part[1 : len(part)-1]
+		s := segment{param: name}
+		if strings.HasSuffix(name, "...") {
+			if i != len(parts)-1 || m.subtree {
+				return m, fmt.Errorf("pattern %q: {%s} must be the final segment", pattern, name)
+			}
+			s.param = strings.TrimSuffix(name, "...")
+			s.rest = true
+		}
+		if s.param == "" || strings.ContainsAny(s.param, "{}.") {
+			return m, fmt.Errorf("pattern %q: invalid parameter name %q", pattern, name)
+		}
+		if seen[s.param] {
+			return m, fmt.Errorf("pattern %q: duplicate parameter %q", pattern, s.param)
+		}
+		seen[s.param] = true
+		m.segments = append(m.segments, s)
+	}
+	return m, nil
+}
+
+func (p patternMatcher) match(path string) (Params, bool) {
+	var params Params
+	capture := func(name, value string) {
+		if params == nil {
+			params = Params{}
+		}
+		params[name] = value
+	}
+	// rest always starts with the slash before the next segment
+	rest := path
+	for _, s := range p.segments {
+		if !strings.HasPrefix(rest, "/") {
+			return nil, false
+		}
+		rest = rest[1:]
+		if s.rest {
+			capture(s.param, rest)
+			return params, true
+		}
+		part := rest
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			part, rest = rest[:i], rest[i:]
+		} else {
+			rest = ""
+		}
+		switch {
+		case s.param == "" && p.fold && !strings.EqualFold(part, s.literal):
+			return nil, false
+		case s.param == "" && !p.fold && part != s.literal:
+			return nil, false
+		case s.param != "" && part == "":
+			return nil, false
+		case s.param != "":
+			capture(s.param, part)
+		}
+	}
+	if p.subtree && !strings.HasPrefix(rest, "/") || !p.subtree && rest != "" {
+		return nil, false
+	}
+	return params, true
+}
+
+func (p patternMatcher) foldCase() pathMatcher {
+	p.fold = true
+	return p
+}
+
+// static returns the literal part of the pattern before the first parameter
+func (p patternMatcher) static() string {
+	static := "/"
+	for i, s := range p.segments {
+		if s.param != "" {
+			return static
+		}
+		static += s.literal
+		if i < len(p.segments)-1 || p.subtree {
+			static += "/"
+		}
+	}
+	return static
+}
+
+func (p patternMatcher) String() string {
+	return p.pattern
+}
@@ -0,0 +1,135 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/stuart-warren/serveit/network"
+)
+
+// RequestMatcher is a condition on the request beyond its host and path
+type RequestMatcher interface {
+	MatchRequest(r *http.Request) bool
+	String() string
+}
+
+type requestMatcher struct {
+	match func(r *http.Request) bool
+	desc  string
+}
+
+func (m requestMatcher) MatchRequest(r *http.Request) bool {
+	return m.match(r)
+}
+
+func (m requestMatcher) String() string {
+	return m.desc
+}
+
+// NewRequestMatcher wraps match as a RequestMatcher, desc is used to describe it
+func NewRequestMatcher(desc string, match func(r *http.Request) bool) RequestMatcher {
+	return requestMatcher{match: match, desc: desc}
+}
+
+// MatchMethod matches requests using any of methods
+func MatchMethod(methods ...string) RequestMatcher {
+	return NewRequestMatcher("method("+strings.Join(methods, ",")+")", func(r *http.Request) bool {
+		for _, m := range methods {
+			if m == r.Method {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// MatchHeader matches requests with a header name set to value, or with name set at all
+// if value is empty
+func MatchHeader(name, value string) RequestMatcher {
+	return NewRequestMatcher(fmt.Sprintf("header(%s=%s)", name, value), func(r *http.Request) bool {
+		return matchValues(r.Header[http.CanonicalHeaderKey(name)], value)
+	})
+}
+
+// MatchQuery matches requests with a query parameter name set to value, or with name set
+// at all if value is empty
+func MatchQuery(name, value string) RequestMatcher {
+	return NewRequestMatcher(fmt.Sprintf("query(%s=%s)", name, value), func(r *http.Request) bool {
+		return matchValues(r.URL.Query()[name], value)
+	})
+}
+
+func matchValues(values []string, value string) bool {
+	if value == "" {
+		return len(values) > 0
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchScheme matches requests the client made over scheme, http or https, which behind
+// trusted proxies is the scheme they report, see Router.WithTrustedProxies
+func MatchScheme(scheme string) RequestMatcher {
+	scheme = strings.ToLower(scheme)
+	return NewRequestMatcher("scheme("+scheme+")", func(r *http.Request) bool {
+		return network.Scheme(r) == scheme
+	})
+}
+
+// MatchRemoteAddr matches requests from a client address within any of cidrs, which is
+// the peer unless it is a trusted proxy, see Router.WithTrustedProxies. It panics if a
+// cidr is invalid.
+func MatchRemoteAddr(cidrs ...string) RequestMatcher {
+	nets, err := network.ParseNetworks(cidrs...)
+	if err != nil {
+		panic(err)
+	}
+	return NewRequestMatcher("remote("+strings.Join(cidrs, ",")+")", func(r *http.Request) bool {
+		ip := network.ClientIP(r)
+		return ip != nil && network.Contains(nets, ip)
+	})
+}
+
+// And matches requests matching all of matchers
+func And(matchers ...RequestMatcher) RequestMatcher {
+	return NewRequestMatcher("and("+describeMatchers(matchers)+")", func(r *http.Request) bool {
+		for _, m := range matchers {
+			if !m.MatchRequest(r) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Or matches requests matching any of matchers
+func Or(matchers ...RequestMatcher) RequestMatcher {
+	return NewRequestMatcher("or("+describeMatchers(matchers)+")", func(r *http.Request) bool {
+		for _, m := range matchers {
+			if m.MatchRequest(r) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Not matches requests that don't match m
+func Not(m RequestMatcher) RequestMatcher {
+	return NewRequestMatcher("not("+m.String()+")", func(r *http.Request) bool {
+		return !m.MatchRequest(r)
+	})
+}
+
+func describeMatchers(matchers []RequestMatcher) string {
+	descs := make([]string, len(matchers))
+	for i, m := range matchers {
+		descs[i] = m.String()
+	}
+	return strings.Join(descs, ",")
+}
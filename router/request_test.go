@@ -0,0 +1,100 @@
+package router_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stuart-warren/serveit/network"
+	"github.com/stuart-warren/serveit/router"
+)
+
+func TestRequestMatchers(t *testing.T) {
+	mux := router.NewRouter(nil, allowAll)
+	mux.Handle(router.NewPrefixRoute("/hooks/").Handler(body("signed")).When(
+		router.MatchMethod("POST"),
+		router.MatchHeader("X-Signature", ""),
+		router.MatchRemoteAddr("10.0.0.0/8"),
+	))
+	mux.Handle(router.NewPrefixRoute("/hooks/").Handler(body("debug")).When(
+		router.Or(router.MatchQuery("debug", "1"), router.MatchHeader("X-Debug", "yes")),
+		router.Not(router.MatchScheme("https")),
+	))
+	mux.Handle(router.NewPrefixRoute("/").Handler(body("default")))
+
+	tests := []struct {
+		method, target, remote string
+		header                 map[string]string
+		body                   string
+	}{
+		{"POST", "/hooks/a", "10.1.2.3:1234", map[string]string{"X-Signature": "abc"}, "signed"},
+		{"POST", "/hooks/a", "192.168.0.1:1234", map[string]string{"X-Signature": "abc"}, "default"},
+		{"GET", "/hooks/a", "10.1.2.3:1234", map[string]string{"X-Signature": "abc"}, "default"},
+		{"POST", "/hooks/a", "10.1.2.3:1234", nil, "default"},
+		{"GET", "/hooks/a?debug=1", "10.1.2.3:1234", nil, "debug"},
+		{"GET", "/hooks/a", "10.1.2.3:1234", map[string]string{"X-Debug": "yes"}, "debug"},
+		{"GET", "https://example.com/hooks/a?debug=1", "10.1.2.3:1234", nil, "default"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, nil)
+		req.RemoteAddr = tt.remote
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Body.String() != tt.body {
+			t.Errorf("%s %s from %s %v: got %q, want %q", tt.method, tt.target, tt.remote, tt.header, rec.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestMatchSchemeBehindProxies(t *testing.T) {
+	muxes := map[network.Header]*router.Router{}
+	for _, header := range []network.Header{network.XForwardedFor, network.Forwarded} {
+		mux := router.NewRouter(body("http"), allowAll).WithTrustedProxies(header, "10.0.0.0/8")
+		mux.Handle(router.NewPrefixRoute("/").Handler(body("https")).When(router.MatchScheme("https")))
+		mux.Handle(router.NewPrefixRoute("/"))
+		muxes[header] = mux
+	}
+	xff, fwd := network.XForwardedFor, network.Forwarded
+	tests := []struct {
+		header network.Header
+		remote string
+		proxy  map[string]string
+		body   string
+	}{
+		{xff, "10.1.2.3:1234", map[string]string{"X-Forwarded-For": "192.0.2.1", "X-Forwarded-Proto": "https"}, "https"},
+		{xff, "10.1.2.3:1234", map[string]string{"X-Forwarded-For": "192.0.2.1", "X-Forwarded-Proto": "https, http"}, "http"},
+		{xff, "10.1.2.3:1234", map[string]string{"X-Forwarded-For": "192.0.2.1", "Forwarded": "for=192.0.2.1;proto=https"}, "http"},
+		{xff, "192.0.2.1:1234", map[string]string{"X-Forwarded-Proto": "https"}, "http"},
+		{fwd, "10.1.2.3:1234", map[string]string{"Forwarded": "for=192.0.2.1;proto=https, for=10.0.0.1;proto=http"}, "https"},
+		{fwd, "10.1.2.3:1234", map[string]string{"Forwarded": "for=192.0.2.1;proto=http", "X-Forwarded-Proto": "https"}, "http"},
+		{fwd, "192.0.2.1:1234", map[string]string{"Forwarded": "for=192.0.2.1;proto=https"}, "http"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remote
+		for k, v := range tt.proxy {
+			req.Header.Set(k, v)
+		}
+		if rec := serveRequest(muxes[tt.header], req); rec.Body.String() != tt.body {
+			t.Errorf("header %d from %s %v: got %q, want %q", tt.header, tt.remote, tt.proxy, rec.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestValidateConditions(t *testing.T) {
+	table := router.NewTable()
+	table.Handle(router.NewPrefixRoute("/hooks/").When(router.MatchMethod("POST")))
+	table.Handle(router.NewPrefixRoute("/hooks/"))
+	table.Handle(router.NewPrefixRoute("/hooks/").When(router.MatchMethod("PUT")))
+	got := []string{}
+	for _, p := range table.Validate() {
+		if p.Kind == router.Unreachable {
+			got = append(got, p.String())
+		}
+	}
+	if len(got) != 1 || got[0] != `unreachable: "/hooks/ when method(PUT)" duplicates "/hooks/"` {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,157 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// RedirectTo returns a copy of rt redirecting authorized requests to target with code, a
+// 3xx status. target is an escaped URL reference which may refer to values rt captures as
+// $name or ${name}, and regex routes to numbered groups as $1 or ${1}. Values are escaped
+// before they are substituted. It panics if code is not a redirect status or rt was not
+// made by this package, see CompileRedirectTo.
+func RedirectTo(rt Route, target string, code int) Route {
+	rt, err := CompileRedirectTo(rt, target, code)
+	if err != nil {
+		panic(err)
+	}
+	return rt
+}
+
+// CompileRedirectTo is like RedirectTo but returns an error instead of panicking
+func CompileRedirectTo(rt Route, target string, code int) (Route, error) {
+	t, ok := rt.(route)
+	if !ok {
+		return nil, fmt.Errorf("route %v can't redirect, it wasn't made by this package", rt)
+	}
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil, fmt.Errorf("invalid redirect status %d", code)
+	}
+	t.redirect, t.code = target, code
+	return t, nil
+}
+
+// RewriteTo returns a copy of rt serving authorized requests as if they were made for
+// target, which is routed again and must be authorized in turn. target may refer to
+// captured values like in RedirectTo. It panics if rt was not made by this package, see
+// CompileRewriteTo.
+func RewriteTo(rt Route, target string) Route {
+	rt, err := CompileRewriteTo(rt, target)
+	if err != nil {
+		panic(err)
+	}
+	return rt
+}
+
+// CompileRewriteTo is like RewriteTo but returns an error instead of panicking
+func CompileRewriteTo(rt Route, target string) (Route, error) {
+	t, ok := rt.(route)
+	if !ok {
+		return nil, fmt.Errorf("route %v can't rewrite, it wasn't made by this package", rt)
+	}
+	t.rewrite = target
+	return t, nil
+}
+
+// RedirectOf returns the target and status set with RedirectTo, target is empty if rt
+// doesn't redirect
+func RedirectOf(rt Route) (target string, code int) {
+	t, _ := rt.(route)
+	return t.redirect, t.code
+}
+
+// RewriteOf returns the target set with RewriteTo, empty if rt doesn't rewrite
+func RewriteOf(rt Route) string {
+	t, _ := rt.(route)
+	return t.rewrite
+}
+
+// expand replaces references to values rt captures from path in target, see RedirectTo.
+// Values are escaped for the part of target they are substituted into, keeping any / in
+// values spanning several segments, so they can never add a query to target.
+func expand(e *entry, target, path string) string {
+	values := captured(e, path)
+	p, query := target, ""
+	i := strings.IndexByte(target, '?')
+	if i >= 0 {
+		p, query = target[:i], target[i+1:]
+	}
+	p = os.Expand(p, func(name string) string {
+		return escapePath(values[name])
+	})
+	if i < 0 {
+		return p
+	}
+	return p + "?" + os.Expand(query, func(name string) string {
+		return url.QueryEscape(values[name])
+	})
+}
+
+// captured returns the values e's route captures from path, regex routes also capture
+// numbered groups
+func captured(e *entry, path string) Params {
+	x, ok := e.matcher.(regexMatcher)
+	if !ok {
+		params, _ := e.capture(path)
+		return params
+	}
+	m := x.pattern.FindStringSubmatch(path)
+	params := Params{}
+	for i, name := range x.pattern.SubexpNames() {
+		if i >= len(m) {
+			break
+		}
+		params[strconv.Itoa(i)] = m[i]
+		if name != "" {
+			params[name] = m[i]
+		}
+	}
+	return params
+}
+
+func escapePath(value string) string {
+	segments := strings.Split(value, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// offHost reports whether target would be followed to another host, as browsers take
+// //host and /\host to be network-path references
+func offHost(target string) bool {
+	return len(target) >= 2 && strings.IndexByte(`/\`, target[0]) >= 0 && strings.IndexByte(`/\`, target[1]) >= 0
+}
+
+// rewrite returns a copy of r for target, an escaped path keeping the original query unless
+// target has one
+func rewrite(r *http.Request, target string) (*http.Request, error) {
+	r2 := new(http.Request)
+	*r2 = *r
+	u := *r.URL
+	p := target
+	if i := strings.IndexByte(target, '?'); i >= 0 {
+		p, u.RawQuery = target[:i], target[i+1:]
+	}
+	path, err := url.PathUnescape(p)
+	if err != nil {
+		return nil, err
+	}
+	u.Path, u.RawPath = path, ""
+	r2.URL = &u
+	return r2, nil
+}
+
+// withQuery appends query to target unless target has a query of its own
+func withQuery(target, query string) string {
+	if query == "" || strings.Contains(target, "?") {
+		return target
+	}
+	return target + "?" + query
+}
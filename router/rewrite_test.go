@@ -0,0 +1,75 @@
+package router_test
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/stuart-warren/serveit/access"
+	"github.com/stuart-warren/serveit/router"
+)
+
+func TestRedirectRoutes(t *testing.T) {
+	ro := access.BlankPermit().MethodRO().AllowUsers("ALL")
+	mux := router.NewRouter(nil, checkUser)
+	mux.Handle(router.RedirectTo(router.NewRegexRoute(regexp.MustCompile(`^/old/(\d+)/(?P<name>[^/]+)$`)), "/new/${name}/$1", http.StatusMovedPermanently).Permit(ro))
+	mux.Handle(router.RedirectTo(router.NewPatternRoute("/users/{id}"), "https://people.example.com/{id}/${id}", http.StatusTemporaryRedirect).Permit(ro))
+	mux.Handle(router.RedirectTo(router.NewPrefixRoute("/access/"), "/login", http.StatusFound).Permit(access.BlankPermit().MethodRO().AllowUsers("some.admin")))
+	mux.Handle(router.RedirectTo(router.NewPatternRoute("/go/{to...}"), "/${to}", http.StatusFound).Permit(ro))
+	mux.Handle(router.RedirectTo(router.NewRegexRoute(regexp.MustCompile(`^/hop(/.*)$`)), "/$1", http.StatusFound).Permit(ro))
+
+	tests := []struct {
+		path     string
+		code     int
+		location string
+	}{
+		{"/old/42/report.pdf?x=1", 301, "/new/report.pdf/42?x=1"},
+		{"/users/bob", 307, "https://people.example.com/{id}/bob"},
+		{"/access/x", 403, ""},
+		{"/go/%5Cevil.com", 302, "/%5Cevil.com"},
+		{"/go/a%20b/c%3Fd", 302, "/a%20b/c%3Fd"},
+		{"/hop/evil.com", 500, ""},
+	}
+	for _, tt := range tests {
+		rec := serve(mux, "GET", tt.path)
+		if rec.Code != tt.code || rec.Header().Get("Location") != tt.location {
+			t.Errorf("%s: got %d %q", tt.path, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+}
+
+func TestRewriteRoutes(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path + "?" + r.URL.RawQuery))
+	})
+	ro := access.BlankPermit().MethodRO().AllowUsers("ALL")
+	mux := router.NewRouter(echo, checkUser)
+	mux.Handle(router.RewriteTo(router.NewRegexRoute(regexp.MustCompile(`^/docs/v1/(.*)$`)), "/archive/docs/$1").Permit(ro))
+	mux.Handle(router.NewPrefixRoute("/archive/").Permit(ro))
+	mux.Handle(router.RewriteTo(router.NewPrefixRoute("/public/"), "/access/").Permit(ro))
+	mux.Handle(router.NewPrefixRoute("/access/").Permit(access.BlankPermit().MethodRO().AllowUsers("some.admin")))
+	mux.Handle(router.RewriteTo(router.NewTextRoute("/loop"), "/loop").Permit(ro))
+	mux.Handle(router.RewriteTo(router.NewPatternRoute("/docs/{name}"), "/archive/${name}").Permit(ro))
+	mux.Handle(router.RewriteTo(router.NewPatternRoute("/find/{q}"), "/archive/search?q=${q}").Permit(ro))
+
+	if rec := serve(mux, "GET", "/docs/v1/intro.html?lang=en"); rec.Code != 200 || rec.Body.String() != "/archive/docs/intro.html?lang=en" {
+		t.Errorf("got %d %q", rec.Code, rec.Body.String())
+	}
+	// escaped values can't replace the query
+	if rec := serve(mux, "GET", "/docs/x%3Fadmin=1?user=bob"); rec.Code != 200 || rec.Body.String() != "/archive/x?admin=1?user=bob" {
+		t.Errorf("got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := serve(mux, "GET", "/find/a&admin=1?user=bob"); rec.Code != 200 || rec.Body.String() != "/archive/search?q=a%26admin%3D1" {
+		t.Errorf("got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := serve(mux, "GET", "/public/"); rec.Code != http.StatusForbidden {
+		t.Errorf("rewrite bypassed target permit, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := serve(mux, "GET", "/loop"); rec.Code != http.StatusInternalServerError {
+		t.Errorf("got %d", rec.Code)
+	}
+	e, _ := mux.ExplainFor("GET", "/docs/v1/a", "")
+	if len(e.Rewrites) != 1 || e.Rewrites[0] != "/archive/docs/a" {
+		t.Errorf("got %v", e.Rewrites)
+	}
+}
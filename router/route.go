@@ -0,0 +1,286 @@
+package router
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/stuart-warren/serveit/access"
+	"github.com/stuart-warren/serveit/middleware"
+)
+
+type Route interface {
+	Match(path string) bool
+	// Capture matches path and returns any values captured from it
+	Capture(path string) (Params, bool)
+	Permit(permitted access.Permitted) Route
+	Permitted() access.Permitted
+	// Handler sets the handler used for any method without its own MethodHandler
+	Handler(handler http.Handler) Route
+	// MethodHandler sets the handler used for a single request method
+	MethodHandler(method string, handler http.Handler) Route
+	// HandlerFor returns the handler registered on the route for method, if any
+	HandlerFor(method string) (http.Handler, bool)
+	// HandledMethods returns the methods with their own MethodHandler
+	HandledMethods() []string
+	// Host restricts the route to requests for any of the given hosts
+	Host(hosts ...string) Route
+	// Hosts returns the hosts the route is restricted to, empty means any host
+	Hosts() []string
+	// When adds a condition the request must meet for the route to match
+	When(conditions ...RequestMatcher) Route
+	// Conditions returns the conditions added with When
+	Conditions() []RequestMatcher
+	// MatchRequest reports whether r meets all of the route's conditions
+	MatchRequest(r *http.Request) bool
+	// Use adds middleware run around the route's handler once the request is authorized,
+	// in the order middleware.Decorate applies them. Each is applied when the route is
+	// added to a router, not for every request.
+	Use(m ...middleware.Middleware) Route
+	// Middleware returns the middleware added with Use
+	Middleware() []middleware.Middleware
+}
+
+type pathMatcher interface {
+	match(path string) (Params, bool)
+	// foldCase returns a copy comparing the path with its literals ignoring case
+	foldCase() pathMatcher
+	String() string
+}
+
+type route struct {
+	matcher   pathMatcher
+	permitted access.Permitted
+	handler   http.Handler
+	handlers  map[string]http.Handler
+	hosts     []string
+	when      []RequestMatcher
+	use       []middleware.Middleware
+	redirect  string
+	code      int
+	rewrite   string
+}
+
+func newRoute(m pathMatcher) route {
+	return route{
+		matcher:   m,
+		permitted: access.Permitted{},
+	}
+}
+
+func (t route) Match(path string) bool {
+	_, ok := t.matcher.match(path)
+	return ok
+}
+
+func (t route) Capture(path string) (Params, bool) {
+	return t.matcher.match(path)
+}
+
+func (t route) Permit(permitted access.Permitted) Route {
+	t.permitted = permitted
+	return t
+}
+
+func (t route) Permitted() access.Permitted {
+	return t.permitted
+}
+
+func (t route) Handler(handler http.Handler) Route {
+	t.handler = handler
+	return t
+}
+
+func (t route) MethodHandler(method string, handler http.Handler) Route {
+	// copy so routes derived from the same value don't share handlers
+	handlers := make(map[string]http.Handler, len(t.handlers)+1)
+	for m, h := range t.handlers {
+		handlers[m] = h
+	}
+	handlers[method] = handler
+	t.handlers = handlers
+	return t
+}
+
+func (t route) HandlerFor(method string) (http.Handler, bool) {
+	if h, ok := t.handlers[method]; ok {
+		return h, true
+	}
+	if h, ok := t.handlers[http.MethodGet]; ok && method == http.MethodHead {
+		return h, true
+	}
+	if t.handler != nil {
+		return t.handler, true
+	}
+	return nil, false
+}
+
+func (t route) HandledMethods() []string {
+	methods := make([]string, 0, len(t.handlers))
+	for m := range t.handlers {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+func (t route) Host(hosts ...string) Route {
+	t.hosts = append(append([]string{}, t.hosts...), hosts...)
+	return t
+}
+
+func (t route) Hosts() []string {
+	return t.hosts
+}
+
+func (t route) When(conditions ...RequestMatcher) Route {
+	t.when = append(append([]RequestMatcher{}, t.when...), conditions...)
+	return t
+}
+
+func (t route) Conditions() []RequestMatcher {
+	return t.when
+}
+
+func (t route) MatchRequest(r *http.Request) bool {
+	for _, m := range t.when {
+		if !m.MatchRequest(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t route) Use(m ...middleware.Middleware) Route {
+	t.use = append(append([]middleware.Middleware{}, t.use...), m...)
+	return t
+}
+
+func (t route) Middleware() []middleware.Middleware {
+	return t.use
+}
+
+func (t route) String() string {
+	return t.matcher.String()
+}
+
+// Kinds of route returned by KindOf
+const (
+	TextKind    = "text"
+	PrefixKind  = "prefix"
+	PatternKind = "pattern"
+	GlobKind    = "glob"
+	RegexKind   = "regex"
+)
+
+// KindOf returns which constructor made r and the path, template, glob or regex it was
+// given, ok is false for routes implemented outside this package
+func KindOf(r Route) (kind, pattern string, ok bool) {
+	rt, ok := r.(route)
+	if !ok {
+		return "", "", false
+	}
+	switch m := rt.matcher.(type) {
+	case textMatcher:
+		return TextKind, m.path, true
+	case prefixMatcher:
+		return PrefixKind, m.prefix, true
+	case patternMatcher:
+		return PatternKind, m.pattern, true
+	case globMatcher:
+		return GlobKind, m.pattern, true
+	case regexMatcher:
+		return RegexKind, m.pattern.String(), true
+	}
+	return "", "", false
+}
+
+type textMatcher struct {
+	path string
+	fold bool
+}
+
+func NewTextRoute(path string) Route {
+	return newRoute(textMatcher{path: path})
+}
+
+func (t textMatcher) match(path string) (Params, bool) {
+	if t.fold {
+		return nil, strings.EqualFold(path, t.path)
+	}
+	return nil, path == t.path
+}
+
+func (t textMatcher) foldCase() pathMatcher {
+	t.fold = true
+	return t
+}
+
+func (t textMatcher) String() string {
+	return t.path
+}
+
+type regexMatcher struct {
+	pattern *regexp.Regexp
+}
+
+// NewRegexRoute returns a route matching pattern, named groups are captured as Params
+func NewRegexRoute(pattern *regexp.Regexp) Route {
+	return newRoute(regexMatcher{pattern: pattern})
+}
+
+func (x regexMatcher) match(path string) (Params, bool) {
+	if x.pattern.NumSubexp() == 0 {
+		return nil, x.pattern.MatchString(path)
+	}
+	m := x.pattern.FindStringSubmatch(path)
+	if m == nil {
+		return nil, false
+	}
+	var params Params
+	for i, name := range x.pattern.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		if params == nil {
+			params = Params{}
+		}
+		params[name] = m[i]
+	}
+	return params, true
+}
+
+func (x regexMatcher) foldCase() pathMatcher {
+	return regexMatcher{pattern: regexp.MustCompile("(?i)" + x.pattern.String())}
+}
+
+func (x regexMatcher) String() string {
+	return x.pattern.String()
+}
+
+type prefixMatcher struct {
+	prefix string
+	fold   bool
+}
+
+func NewPrefixRoute(prefix string) Route {
+	return newRoute(prefixMatcher{prefix: prefix})
+}
+
+func (p prefixMatcher) match(path string) (Params, bool) {
+	if p.fold {
+		return nil, len(path) >= len(p.prefix) && strings.EqualFold(path[0:len(p.prefix)], p.prefix)
+	}
+	// strings.HasPrefix(s, prefix string) bool
+	return nil, len(path) >= len(p.prefix) && path[0:len(p.prefix)] == p.prefix
+}
+
+func (p prefixMatcher) foldCase() pathMatcher {
+	p.fold = true
+	return p
+}
+
+func (p prefixMatcher) String() string {
+	return p.prefix
+}
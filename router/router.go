@@ -2,144 +2,274 @@ package router
 
 import (
 	"net/http"
-	"regexp"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/stuart-warren/serveit/access"
+	"github.com/stuart-warren/serveit/identity"
+	"github.com/stuart-warren/serveit/network"
 )
 
-type Route interface {
-	Match(path string) bool
-	Permit(permitted access.Permitted) Route
-	Permitted() access.Permitted
-}
-
-type textRoute struct {
-	path      string
-	permitted access.Permitted
-}
-
-func NewTextRoute(path string) Route {
-	return textRoute{
-		path:      path,
-		permitted: access.Permitted{},
-	}
-}
-
-func (t textRoute) Permit(permitted access.Permitted) Route {
-	t.permitted = permitted
-	return t
-}
-
-func (t textRoute) Permitted() access.Permitted {
-	return t.permitted
-}
-
-func (t textRoute) Match(path string) bool {
-	return path == t.path
+type Router struct {
+	// mu serialises writers, requests read the current table, which also holds the
+	// router's config, without locking
+	mu    sync.Mutex
+	table atomic.Value
+	rule  Rule
 }
 
-func (t textRoute) String() string {
-	return t.path
+// NewRouter returns a Router which serves matching routes with their own handler,
+// falling back to handler (which may be nil) for routes without one
+func NewRouter(handler http.Handler, authorized func(w http.ResponseWriter, r *http.Request, route Route) bool) *Router {
+	return NewRuleRouter(handler, BoolRule("authorized", authorized))
 }
 
-type regexRoute struct {
-	pattern   *regexp.Regexp
-	permitted access.Permitted
+// NewRuleRouter returns a Router like NewRouter authorizing requests with rule, whose
+// decisions are reported by Explain
+func NewRuleRouter(handler http.Handler, rule Rule) *Router {
+	o := &Router{rule: rule}
+	o.table.Store(newTable([]Route{}, config{handler: handler, renderError: PlainTextErrors}))
+	return o
 }
 
-func NewRegexRoute(pattern *regexp.Regexp) Route {
-	return regexRoute{
-		pattern:   pattern,
-		permitted: access.Permitted{},
-	}
+func (o *Router) load() *table {
+	return o.table.Load().(*table)
 }
 
-func (x regexRoute) Permit(permitted access.Permitted) Route {
-	x.permitted = permitted
-	return x
+// configure swaps in a table with the current routes and config changed by f
+func (o *Router) configure(f func(c *config)) *Router {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	t := o.load()
+	c := t.config
+	f(&c)
+	o.table.Store(newTable(t.routes, c))
+	return o
 }
 
-func (x regexRoute) Permitted() access.Permitted {
-	return x.permitted
+// Reset removes all routes, use Replace to swap in a new set without a gap
+func (o *Router) Reset() {
+	o.Replace(NewTable())
 }
 
-func (x regexRoute) Match(path string) bool {
-	return x.pattern.MatchString(path)
+// Replace atomically swaps the routes served by the router for those in t, requests
+// in flight finish against the previous routes. Later changes to t have no effect.
+func (o *Router) Replace(t *Table) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.table.Store(newTable(t.Routes(), o.load().config))
 }
 
-func (x regexRoute) String() string {
-	return x.pattern.String()
+// Routes returns the routes currently served in registration order
+func (o *Router) Routes() []Route {
+	return append([]Route{}, o.load().routes...)
 }
 
-type prefixRoute struct {
-	prefix    string
-	permitted access.Permitted
+// Handle registers route. Requests are served by the most specific matching route
+// regardless of registration order: routes for the request's exact host, then wildcard
+// hosts, then any host, and within those an exact text route, then the route with the
+// longest literal prefix, where template and glob routes beat prefix routes. Regex routes
+// are only tried, in registration order, when nothing else matches. Routes whose
+// conditions the request doesn't meet are skipped.
+//
+// Each call rebuilds the route index, use a Table and Replace to load many routes.
+func (o *Router) Handle(route Route) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	routes := append(o.Routes(), route)
+	o.table.Store(newTable(routes, o.load().config))
 }
 
-func NewPrefixRoute(prefix string) Route {
-	return prefixRoute{
-		prefix:    prefix,
-		permitted: access.Permitted{},
+// WithTrustedProxies believes the client address and scheme proxies within cidrs report
+// in header, see network.Resolver. It panics if a cidr is invalid.
+func (o *Router) WithTrustedProxies(header network.Header, cidrs ...string) *Router {
+	res, err := network.NewResolver(header, cidrs...)
+	if err != nil {
+		panic(err)
 	}
+	return o.configure(func(c *config) { c.clients = res })
 }
 
-func (p prefixRoute) Permit(permitted access.Permitted) Route {
-	p.permitted = permitted
-	return p
-}
-
-func (p prefixRoute) Permitted() access.Permitted {
-	return p.permitted
-}
-
-func (p prefixRoute) Match(path string) bool {
-	// strings.HasPrefix(s, prefix string) bool
-	return len(path) >= len(p.prefix) && path[0:len(p.prefix)] == p.prefix
-}
-
-func (p prefixRoute) String() string {
-	return p.prefix
+// ServeHTTP serves the most specific route for the request, see Handle. Any
+// identity.UserHeader is replaced by the name of the identity an authenticator verified,
+// or removed if there isn't one, so handlers never see one a client made up.
+func (o *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.Header.Del(identity.UserHeader)
+	if id, ok := identity.FromRequest(r); ok && id.Name() != "" {
+		r.Header.Set(identity.UserHeader, id.Name())
+	}
+	t := o.load()
+	e, r, handler := o.decide(t, w, r)
+	t.audit(r, e)
+	switch e.Status {
+	case http.StatusOK:
+		handler.ServeHTTP(w, r)
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		http.Redirect(w, r, e.Location, e.Status)
+	case http.StatusMethodNotAllowed:
+		w.Header().Set("Allow", e.Allow)
+		t.renderError(w, r, e.Status)
+	case http.StatusForbidden:
+		if t.hideForbidden {
+			t.renderError(w, r, http.StatusNotFound)
+			return
+		}
+		t.renderError(w, r, e.Status)
+	default:
+		t.renderError(w, r, e.Status)
+	}
 }
 
-type Router struct {
-	mu         sync.RWMutex
-	routes     []Route
-	handler    http.Handler
-	authorized func(http.ResponseWriter, *http.Request, Route) bool
-}
+// maxRewrites limits how many rewrite routes a request passes through, to break cycles
+const maxRewrites = 10
 
-func NewRouter(handler http.Handler, authorized func(w http.ResponseWriter, r *http.Request, route Route) bool) *Router {
-	return &Router{
-		routes:     []Route{},
-		handler:    handler,
-		authorized: authorized,
+// decide finds the route for r and whether it may be served, returning the request
+// with any captured params and the handler to serve it with. Routes are only matched
+// against canonical paths, others are redirected or rejected so the handler can never
+// resolve a path differently to the router. Redirect and rewrite routes are only
+// followed once the request is authorized for them.
+func (o *Router) decide(t *table, w http.ResponseWriter, r *http.Request) (Explanation, *http.Request, http.Handler) {
+	e := Explanation{
+		Method: r.Method,
+		Host:   r.Host,
+		Path:   r.URL.Path,
+		User:   user(r),
+		Status: http.StatusNotFound,
+	}
+	if _, ok := network.FromRequest(r); !ok {
+		ctx := network.NewContext(r.Context(), t.clients.ClientIP(r))
+		r = r.WithContext(network.NewSchemeContext(ctx, t.clients.Scheme(r)))
+	}
+	if ip := network.ClientIP(r); ip != nil {
+		e.Client = ip.String()
+	}
+	canonical, ok := canonicalPath(r.URL)
+	if !ok {
+		e.Status, e.Reason = http.StatusBadRequest, "invalid path"
+		return e, r, nil
+	}
+	if !isCanonical(r.URL, canonical) {
+		if t.pathPolicy == RejectNonCanonical {
+			e.Status, e.Reason = http.StatusBadRequest, "non-canonical path"
+			return e, r, nil
+		}
+		e.Location, e.Status = canonicalRedirect(r, canonical)
+		e.Reason = "non-canonical path"
+		return e, r, nil
+	}
+	for rewrites := 0; ; rewrites++ {
+		path := canonical
+		ent, params, ok := t.index.lookup(r, path)
+		if !ok {
+			e.Route, e.Permitted, e.Params = nil, access.Permitted{}, nil
+			e.Reason = "no route matches"
+			return e, r, nil
+		}
+		route := ent.route
+		e.Route, e.Permitted, e.Params = route, route.Permitted(), params
+		if len(params) > 0 {
+			r = r.WithContext(withParams(r.Context(), params))
+		}
+		if target, code := RedirectOf(route); target != "" {
+			if !o.authorize(w, r, route, &e) {
+				return e, r, nil
+			}
+			location := expand(ent, target, path)
+			if offHost(location) {
+				e.Allowed = false
+				e.Status, e.Reason = http.StatusInternalServerError, "invalid redirect"
+				return e, r, nil
+			}
+			e.Location, e.Status = withQuery(location, r.URL.RawQuery), code
+			e.Reason = "redirected"
+			return e, r, nil
+		}
+		if target := RewriteOf(route); target != "" {
+			if !o.authorize(w, r, route, &e) {
+				return e, r, nil
+			}
+			if rewrites == maxRewrites {
+				e.Allowed = false
+				e.Status, e.Reason = http.StatusInternalServerError, "too many rewrites"
+				return e, r, nil
+			}
+			location := expand(ent, target, path)
+			rewritten, err := rewrite(r, location)
+			if err == nil {
+				r = rewritten
+				canonical, ok = canonicalPath(r.URL)
+			}
+			if err != nil || !ok || offHost(location) {
+				e.Allowed = false
+				e.Status, e.Reason = http.StatusInternalServerError, "invalid rewrite"
+				return e, r, nil
+			}
+			r.URL.Path, r.URL.RawPath = canonical, ""
+			e.Rewrites = append(e.Rewrites, canonical)
+			continue
+		}
+		handler, ok := ent.handlerFor(r.Method)
+		if !ok {
+			if methods := route.HandledMethods(); len(methods) > 0 {
+				// a 405 would reveal a route the client may not know about
+				if t.hideForbidden && !o.authorize(w, r, route, &e) {
+					return e, r, nil
+				}
+				e.Status, e.Allow = http.StatusMethodNotAllowed, allow(methods)
+				e.Reason = "route has no handler for " + r.Method
+				return e, r, nil
+			}
+			handler = ent.fallback
+		}
+		if !o.authorize(w, r, route, &e) {
+			return e, r, nil
+		}
+		if handler == nil {
+			e.Status, e.Reason = http.StatusNotFound, "route has no handler"
+			return e, r, nil
+		}
+		e.Status, e.Reason = http.StatusOK, "allowed"
+		return e, r, handler
 	}
 }
 
-func (o *Router) Reset() {
-	o.mu.Lock()
-	defer o.mu.Unlock()
-	o.routes = []Route{}
+func user(r *http.Request) string {
+	id, _ := identity.FromRequest(r)
+	return id.Name()
 }
 
-func (o *Router) Handle(route Route) {
-	o.mu.Lock()
-	defer o.mu.Unlock()
-	o.routes = append(o.routes, route)
+// authorize runs denyRule and, unless it denies, the router's rule for route, recording
+// the outcome in e
+func (o *Router) authorize(w http.ResponseWriter, r *http.Request, route Route, e *Explanation) bool {
+	d := denyRule(w, r, route)
+	if d.Abstained {
+		d = o.rule(w, r, route)
+	}
+	e.Allowed = d.Allowed && !d.Abstained
+	e.Decisions = append(e.Decisions, d)
+	if !e.Allowed {
+		e.Status, e.Reason = http.StatusForbidden, "denied: "+d.String()
+	}
+	return e.Allowed
 }
 
-func (o *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	for _, route := range o.routes {
-		if route.Match(r.URL.Path) {
-			if o.authorized(w, r, route) {
-				o.handler.ServeHTTP(w, r)
-				return
-			} else {
-				http.Error(w, "403 Forbidden", http.StatusForbidden)
-				return
-			}
+func allow(methods []string) string {
+	for _, m := range methods {
+		if m == http.MethodGet {
+			methods = append(methods, http.MethodHead)
+			break
+		}
+	}
+	seen := map[string]bool{}
+	out := []string{}
+	for _, m := range methods {
+		if !seen[m] {
+			seen[m] = true
+			out = append(out, m)
 		}
 	}
-	http.Error(w, "404 page not found", http.StatusNotFound)
+	sort.Strings(out)
+	return strings.Join(out, ", ")
 }
@@ -0,0 +1,364 @@
+package router_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/stuart-warren/serveit/access"
+	"github.com/stuart-warren/serveit/identity"
+	"github.com/stuart-warren/serveit/middleware"
+	"github.com/stuart-warren/serveit/network"
+	"github.com/stuart-warren/serveit/router"
+)
+
+func allowAll(w http.ResponseWriter, r *http.Request, route router.Route) bool {
+	return true
+}
+
+func denyAll(w http.ResponseWriter, r *http.Request, route router.Route) bool {
+	return false
+}
+
+func body(s string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(s))
+	}
+}
+
+func serve(h http.Handler, method, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	return rec
+}
+
+func TestRouteHandlers(t *testing.T) {
+	mux := router.NewRouter(body("default"), allowAll)
+	mux.Handle(router.NewTextRoute("/file").
+		MethodHandler(http.MethodGet, body("get")).
+		MethodHandler(http.MethodPut, body("put")))
+	mux.Handle(router.NewPrefixRoute("/metrics").Handler(body("metrics")))
+	mux.Handle(router.NewPrefixRoute("/"))
+
+	tests := []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{"GET", "/file", 200, "get"},
+		{"HEAD", "/file", 200, "get"},
+		{"PUT", "/file", 200, "put"},
+		{"POST", "/file", 405, "405 method not allowed\n"},
+		{"POST", "/metrics", 200, "metrics"},
+		{"GET", "/other", 200, "default"},
+	}
+	for _, tt := range tests {
+		rec := serve(mux, tt.method, tt.path)
+		if rec.Code != tt.code || rec.Body.String() != tt.body {
+			t.Errorf("%s %s: got %d %q, want %d %q", tt.method, tt.path, rec.Code, rec.Body.String(), tt.code, tt.body)
+		}
+	}
+	rec := serve(mux, "DELETE", "/file")
+	if allow := rec.Header().Get("Allow"); allow != "GET, HEAD, PUT" {
+		t.Errorf("got Allow %q", allow)
+	}
+}
+
+func TestMethodNotAllowedBeforeForbidden(t *testing.T) {
+	mux := router.NewRouter(nil, denyAll)
+	mux.Handle(router.NewTextRoute("/file").MethodHandler(http.MethodGet, body("get")).Permit(access.BlankPermit()))
+	if rec := serve(mux, "PUT", "/file"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got %d", rec.Code)
+	}
+	if rec := serve(mux, "GET", "/file"); rec.Code != http.StatusForbidden {
+		t.Errorf("got %d", rec.Code)
+	}
+}
+
+func TestDeniedGetDeniesHead(t *testing.T) {
+	mux := router.NewRouter(nil, allowAll)
+	mux.Handle(router.NewTextRoute("/file").MethodHandler(http.MethodGet, body("get")).Permit(access.BlankPermit().DenyMethods("GET")))
+	for _, method := range []string{"GET", "HEAD"} {
+		if rec := serve(mux, method, "/file"); rec.Code != http.StatusForbidden {
+			t.Errorf("%s: got %d", method, rec.Code)
+		}
+	}
+}
+
+func TestNoHandler(t *testing.T) {
+	mux := router.NewRouter(nil, allowAll)
+	mux.Handle(router.NewPrefixRoute("/"))
+	if rec := serve(mux, "GET", "/"); rec.Code != http.StatusNotFound {
+		t.Errorf("got %d", rec.Code)
+	}
+}
+
+func TestPatternRoute(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		match         bool
+		params        router.Params
+	}{
+		{"/users/{id}", "/users/42", true, router.Params{"id": "42"}},
+		{"/users/{id}", "/users/42/", false, nil},
+		{"/users/{id}", "/users/", false, nil},
+		{"/users/{id}", "/groups/42", false, nil},
+		{"/users/{id}/files/{path...}", "/users/42/files/a/b.txt", true, router.Params{"id": "42", "path": "a/b.txt"}},
+		{"/users/{id}/files/{path...}", "/users/42/files/", true, router.Params{"id": "42", "path": ""}},
+		{"/users/{id}/files/{path...}", "/users/42/files", false, nil},
+		{"/home/{user}/", "/home/bob/", true, router.Params{"user": "bob"}},
+		{"/home/{user}/", "/home/bob/docs/x", true, router.Params{"user": "bob"}},
+		{"/home/{user}/", "/home/bob", false, nil},
+		{"/", "/anything", true, nil},
+	}
+	for _, tt := range tests {
+		params, ok := router.NewPatternRoute(tt.pattern).Capture(tt.path)
+		if ok != tt.match || len(params) != len(tt.params) {
+			t.Errorf("%s %s: got %v %v", tt.pattern, tt.path, ok, params)
+			continue
+		}
+		for k, v := range tt.params {
+			if params[k] != v {
+				t.Errorf("%s %s: got %s=%q, want %q", tt.pattern, tt.path, k, params[k], v)
+			}
+		}
+	}
+}
+
+func TestParamsInContext(t *testing.T) {
+	owner := func(w http.ResponseWriter, r *http.Request, route router.Route) bool {
+		id, _ := identity.FromRequest(r)
+		return router.Param(r, "user") == id.Email
+	}
+	mux := router.NewRouter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(router.Param(r, "path")))
+	}), owner)
+	mux.Handle(router.NewPatternRoute("/home/{user}/{path...}"))
+
+	req := httptest.NewRequest("PUT", "/home/bob/notes.txt", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, as(req, "bob"))
+	if rec.Code != http.StatusOK || rec.Body.String() != "notes.txt" {
+		t.Errorf("got %d %q", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, as(req, "eve"))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("got %d", rec.Code)
+	}
+}
+
+func TestHostRoutes(t *testing.T) {
+	mux := router.NewRouter(nil, allowAll)
+	mux.Handle(router.NewPrefixRoute("/").Host("docs.example.com").Handler(body("docs")))
+	mux.Handle(router.NewPrefixRoute("/upload/").Host("files.example.com").Handler(body("upload")))
+	mux.Handle(router.NewPrefixRoute("/").Host("files.example.com").Handler(body("files")))
+	mux.Handle(router.NewPrefixRoute("/").Host("*.example.com").Handler(body("wildcard")))
+	mux.Handle(router.NewPrefixRoute("/").Handler(body("default")))
+
+	tests := []struct {
+		host, path, body string
+	}{
+		{"docs.example.com", "/", "docs"},
+		{"DOCS.example.com:8443", "/", "docs"},
+		{"files.example.com", "/upload/x", "upload"},
+		{"files.example.com", "/x", "files"},
+		{"other.example.com", "/", "wildcard"},
+		{"a.b.example.com", "/", "default"},
+		{"example.com", "/", "default"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Host = tt.host
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Body.String() != tt.body {
+			t.Errorf("%s%s: got %q, want %q", tt.host, tt.path, rec.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestMostSpecificRoute(t *testing.T) {
+	mux := router.NewRouter(nil, allowAll)
+	mux.Handle(router.NewPrefixRoute("/").Handler(body("root")))
+	mux.Handle(router.NewRegexRoute(regexp.MustCompile(`^/access/.*\.txt$`)).Handler(body("regex")))
+	mux.Handle(router.NewPrefixRoute("/access/").Handler(body("access")))
+	mux.Handle(router.NewTextRoute("/access/index.html").Handler(body("index")))
+	mux.Handle(router.NewPatternRoute("/access/{user}/").Handler(body("user")))
+	mux.Handle(router.NewPrefixRoute("/acc").Handler(body("acc")))
+
+	tests := []struct {
+		path, body string
+	}{
+		{"/", "root"},
+		{"/other", "root"},
+		{"/acc", "acc"},
+		{"/access", "acc"},
+		{"/access/", "access"},
+		{"/access/x.txt", "access"},
+		{"/access/index.html", "index"},
+		{"/access/bob/", "user"},
+		{"/access/bob/x", "user"},
+	}
+	for _, tt := range tests {
+		if rec := serve(mux, "GET", tt.path); rec.Body.String() != tt.body {
+			t.Errorf("%s: got %q, want %q", tt.path, rec.Body.String(), tt.body)
+		}
+	}
+
+	mux = router.NewRouter(nil, allowAll)
+	mux.Handle(router.NewRegexRoute(regexp.MustCompile(`^/access/.*\.txt$`)).Handler(body("regex")))
+	mux.Handle(router.NewPrefixRoute("/access/private/").Handler(body("private")))
+	if rec := serve(mux, "GET", "/access/x.txt"); rec.Body.String() != "regex" {
+		t.Errorf("got %q", rec.Body.String())
+	}
+}
+
+func BenchmarkRouter(b *testing.B) {
+	mux := router.NewRouter(body(""), allowAll)
+	table := router.NewTable()
+	for i := 0; i < 5000; i++ {
+		table.Handle(router.NewPrefixRoute(fmt.Sprintf("/tenant/%d/", i)))
+		table.Handle(router.NewTextRoute(fmt.Sprintf("/tenant/%d/index.html", i)))
+	}
+	table.Handle(router.NewPrefixRoute("/"))
+	mux.Replace(table)
+	req := httptest.NewRequest("GET", "/tenant/4321/static/app.js", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+func TestReplaceDuringRequests(t *testing.T) {
+	mux := router.NewRouter(nil, allowAll)
+	mux.Handle(router.NewPrefixRoute("/").Handler(body("v0")))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 100; i++ {
+			table := router.NewTable()
+			table.Handle(router.NewPrefixRoute("/").Handler(body(fmt.Sprintf("v%d", i))))
+			mux.Replace(table)
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			if rec := serve(mux, "GET", "/"); rec.Body.String() != "v100" {
+				t.Errorf("got %q", rec.Body.String())
+			}
+			return
+		default:
+			if rec := serve(mux, "GET", "/"); rec.Code != http.StatusOK {
+				t.Fatalf("got %d during reload", rec.Code)
+			}
+		}
+	}
+}
+
+func TestReconfigureDuringRequests(t *testing.T) {
+	mux := router.NewRouter(nil, denyAll)
+	mux.Handle(router.NewPrefixRoute("/").Handler(body("ok")))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			mux.WithErrorRenderer(router.ProblemJSONErrors).WithPathPolicy(router.RejectNonCanonical).
+				WithForbiddenAsNotFound().WithTrustedProxies(network.XForwardedFor, "10.0.0.0/8")
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			if rec := serve(mux, "GET", "/x"); rec.Code != http.StatusNotFound || rec.Header().Get("Content-Type") != "application/problem+json" {
+				t.Errorf("got %d %v", rec.Code, rec.Header())
+			}
+			return
+		default:
+			if rec := serve(mux, "GET", "/x"); rec.Code != http.StatusForbidden && rec.Code != http.StatusNotFound {
+				t.Fatalf("got %d during reconfiguration", rec.Code)
+			}
+		}
+	}
+}
+
+func TestRouteMiddleware(t *testing.T) {
+	mux := router.NewRouter(body("static"), checkUser)
+	mux.Handle(router.NewPrefixRoute("/assets/").
+		Use(middleware.ResponseHeader("Cache-Control", "max-age=3600"), middleware.ResponseHeader("X-Route", "assets")).
+		Permit(access.BlankPermit().MethodRO().AllowUsers("ALL")))
+	mux.Handle(router.NewPrefixRoute("/private/").
+		Use(middleware.ResponseHeader("Cache-Control", "max-age=3600")).
+		Permit(access.BlankPermit().MethodRO().AllowUsers("some.admin")))
+	mux.Handle(router.NewPrefixRoute("/").Permit(access.BlankPermit().MethodRO().AllowUsers("ALL")))
+	h := middleware.Decorate(mux, middleware.ResponseHeader("X-Global", "yes"))
+
+	rec := serve(h, "GET", "/assets/app.js")
+	if rec.Header().Get("Cache-Control") != "max-age=3600" || rec.Header().Get("X-Route") != "assets" || rec.Header().Get("X-Global") != "yes" {
+		t.Errorf("got %v", rec.Header())
+	}
+	rec = serve(h, "GET", "/index.html")
+	if rec.Header().Get("Cache-Control") != "" || rec.Header().Get("X-Global") != "yes" {
+		t.Errorf("got %v", rec.Header())
+	}
+	rec = serve(h, "GET", "/private/x")
+	if rec.Code != http.StatusForbidden || rec.Header().Get("Cache-Control") != "" {
+		t.Errorf("route middleware ran before authorization: %d %v", rec.Code, rec.Header())
+	}
+}
+
+func TestRouteMiddlewareCreatedOnce(t *testing.T) {
+	created := 0
+	count := func(h http.Handler) http.Handler {
+		created++
+		return h
+	}
+	mux := router.NewRouter(body("static"), allowAll)
+	mux.Handle(router.NewPrefixRoute("/").Use(count))
+	for i := 0; i < 3; i++ {
+		if rec := serve(mux, "GET", "/x"); rec.Body.String() != "static" {
+			t.Fatalf("got %q", rec.Body.String())
+		}
+	}
+	if created != 1 {
+		t.Errorf("middleware created %d times", created)
+	}
+}
+
+func TestUserHeaderStripped(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("User")))
+	})
+	mux := router.NewRouter(echo, checkUser)
+	mux.Handle(router.NewPrefixRoute("/access/").Permit(access.BlankPermit().MethodRO().AllowUsers("some.admin")))
+	mux.Handle(router.NewPrefixRoute("/").Permit(access.BlankPermit().MethodRO().AllowUsers("ALL")))
+
+	req := httptest.NewRequest("GET", "/access/x", nil)
+	req.Header.Set("User", "some.admin")
+	if rec := serveRequest(mux, req); rec.Code != http.StatusForbidden {
+		t.Errorf("trusted User header, got %d", rec.Code)
+	}
+	req = httptest.NewRequest("GET", "/x", nil)
+	req.Header.Set("User", "some.admin")
+	if rec := serveRequest(mux, req); rec.Body.String() != "" {
+		t.Errorf("passed on User header %q", rec.Body.String())
+	}
+	// authenticators needn't remove it themselves
+	req = httptest.NewRequest("GET", "/x", nil)
+	req.Header.Set("User", "some.admin")
+	if rec := serveRequest(mux, as(req, "bob@example.com")); rec.Body.String() != "bob@example.com" {
+		t.Errorf("passed on User header %q", rec.Body.String())
+	}
+}
+
+func serveRequest(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
@@ -0,0 +1,110 @@
+package router
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+
+	"github.com/stuart-warren/serveit/identity"
+)
+
+// Split is a handler dividing requests between several handlers, for canary releases.
+// Requests matching a header or cookie rule go to that rule's handler, in the order the
+// rules were added, the rest are divided between the weighted handlers. Use it as a
+// route's handler so requests are authorized against the route's permits first.
+type Split struct {
+	rules    []splitRule
+	weighted []weighted
+	total    int
+	key      func(r *http.Request) string
+}
+
+type splitRule struct {
+	match   RequestMatcher
+	handler http.Handler
+}
+
+type weighted struct {
+	weight  int
+	handler http.Handler
+}
+
+// NewSplit returns a Split which assigns users to weighted handlers by their identity
+func NewSplit() Split {
+	return Split{key: splitUser}
+}
+
+func splitUser(r *http.Request) string {
+	id, _ := identity.FromRequest(r)
+	return id.Name()
+}
+
+// Header sends requests with header name set to value to handler
+func (s Split) Header(name, value string, handler http.Handler) Split {
+	return s.When(MatchHeader(name, value), handler)
+}
+
+// Cookie sends requests with cookie name set to value to handler
+func (s Split) Cookie(name, value string, handler http.Handler) Split {
+	return s.When(NewRequestMatcher("cookie("+name+"="+value+")", func(r *http.Request) bool {
+		c, err := r.Cookie(name)
+		return err == nil && c.Value == value
+	}), handler)
+}
+
+// When sends requests matching m to handler
+func (s Split) When(m RequestMatcher, handler http.Handler) Split {
+	s.rules = append(append([]splitRule{}, s.rules...), splitRule{match: m, handler: handler})
+	return s
+}
+
+// Weighted gives handler weight shares of the requests not matched by a rule
+func (s Split) Weighted(weight int, handler http.Handler) Split {
+	if weight < 0 {
+		weight = 0
+	}
+	s.weighted = append(append([]weighted{}, s.weighted...), weighted{weight: weight, handler: handler})
+	s.total += weight
+	return s
+}
+
+// StickyBy sets how requests are assigned a key, requests with the same key always get
+// the same weighted handler while the weights are unchanged. Requests without a key are
+// assigned at random. The default key is the user.
+func (s Split) StickyBy(key func(r *http.Request) string) Split {
+	s.key = key
+	return s
+}
+
+func (s Split) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, rule := range s.rules {
+		if rule.match.MatchRequest(r) {
+			rule.handler.ServeHTTP(w, r)
+			return
+		}
+	}
+	if s.total == 0 {
+		http.Error(w, "503 service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	key := s.key
+	if key == nil {
+		// the zero Split assigns users like NewSplit
+		key = splitUser
+	}
+	var n int
+	if k := key(r); k != "" {
+		h := fnv.New32a()
+		h.Write([]byte(k))
+		n = int(h.Sum32() % uint32(s.total))
+	} else {
+		n = rand.Intn(s.total)
+	}
+	for _, wh := range s.weighted {
+		if n < wh.weight {
+			wh.handler.ServeHTTP(w, r)
+			return
+		}
+		n -= wh.weight
+	}
+}
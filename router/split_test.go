@@ -0,0 +1,69 @@
+package router_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stuart-warren/serveit/access"
+	"github.com/stuart-warren/serveit/router"
+)
+
+func TestSplit(t *testing.T) {
+	split := router.NewSplit().
+		Header("X-Canary", "1", body("canary")).
+		Cookie("release", "canary", body("canary")).
+		Weighted(80, body("stable")).
+		Weighted(20, body("canary"))
+	mux := router.NewRouter(nil, checkUser)
+	mux.Handle(router.NewPrefixRoute("/app/").Handler(split).Permit(access.BlankPermit().MethodRO().AllowUsers("ALL")))
+	mux.Handle(router.NewPrefixRoute("/admin/").Handler(split).Permit(access.BlankPermit().MethodRO().AllowUsers("some.admin")))
+
+	get := func(path string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		if user := header["User"]; user != "" {
+			req = as(req, user)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := get("/app/", map[string]string{"X-Canary": "1", "User": "a"}); rec.Body.String() != "canary" {
+		t.Errorf("got %q", rec.Body.String())
+	}
+	if rec := get("/app/", map[string]string{"Cookie": "release=canary"}); rec.Body.String() != "canary" {
+		t.Errorf("got %q", rec.Body.String())
+	}
+	if rec := get("/admin/", map[string]string{"X-Canary": "1"}); rec.Code != http.StatusForbidden {
+		t.Errorf("split ignored permits, got %d", rec.Code)
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		user := map[string]string{"User": fmt.Sprintf("user%d@example.com", i)}
+		first := get("/app/", user).Body.String()
+		for j := 0; j < 3; j++ {
+			if again := get("/app/", user).Body.String(); again != first {
+				t.Fatalf("user%d not sticky: %q then %q", i, first, again)
+			}
+		}
+		counts[first]++
+	}
+	if counts["canary"] < 120 || counts["canary"] > 280 {
+		t.Errorf("canary share %v", counts)
+	}
+}
+
+func TestZeroSplit(t *testing.T) {
+	split := router.Split{}.Weighted(1, body("stable"))
+	if rec := serveRequest(split, as(httptest.NewRequest("GET", "/", nil), "bob@example.com")); rec.Body.String() != "stable" {
+		t.Errorf("got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := serve(split, "GET", "/"); rec.Body.String() != "stable" {
+		t.Errorf("got %d %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,120 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/stuart-warren/serveit/middleware"
+	"github.com/stuart-warren/serveit/network"
+)
+
+// Table is a set of routes built off to the side and swapped into a Router in one
+// step with Replace, so requests never see a partially loaded set of routes
+type Table struct {
+	routes []Route
+}
+
+func NewTable() *Table {
+	return &Table{routes: []Route{}}
+}
+
+// Handle adds route to the table, see Router.Handle for how routes are matched
+func (t *Table) Handle(route Route) {
+	t.routes = append(t.routes, route)
+}
+
+// Routes returns the routes in registration order
+func (t *Table) Routes() []Route {
+	return append([]Route{}, t.routes...)
+}
+
+// config is how a Router serves requests, set by its constructor and With methods
+type config struct {
+	// handler serves routes without a handler of their own for the request method
+	handler    http.Handler
+	pathPolicy PathPolicy
+	foldCase   bool
+	// clients finds the address rules and matchers check, trusting no proxies by default
+	clients network.Resolver
+	// renderError writes responses for errors the router produces itself
+	renderError   ErrorRenderer
+	hideForbidden bool
+	auditor       Auditor
+}
+
+// table is an immutable snapshot of the routes served by a Router and how it serves
+// them, so reconfiguring a router serving requests is as safe as replacing its routes
+type table struct {
+	routes []Route
+	index  *index
+	config
+}
+
+func newTable(routes []Route, c config) *table {
+	x := newIndex(c.foldCase)
+	for _, r := range routes {
+		x.add(newEntry(r, c))
+	}
+	return &table{routes: routes, index: x, config: c}
+}
+
+// entry is a route in a table with its handlers already wrapped in the route's
+// middleware, so middleware is created once per table rather than for every request
+type entry struct {
+	route Route
+	// matcher matches the path for routes made by this package, ignoring case if the
+	// router does
+	matcher pathMatcher
+	// methods serves the methods with their own MethodHandler
+	methods map[string]http.Handler
+	// other serves any other method, fallback is the router's handler used when the
+	// route has none, either may be nil
+	other, fallback http.Handler
+}
+
+func newEntry(rt Route, c config) *entry {
+	use := rt.Middleware()
+	decorate := func(h http.Handler) http.Handler {
+		if h == nil {
+			return nil
+		}
+		return middleware.Decorate(h, use...)
+	}
+	e := &entry{route: rt, methods: map[string]http.Handler{}, fallback: decorate(c.handler)}
+	if t, ok := rt.(route); ok {
+		e.matcher = t.matcher
+		if c.foldCase {
+			e.matcher = e.matcher.foldCase()
+		}
+	}
+	for _, m := range rt.HandledMethods() {
+		h, _ := rt.HandlerFor(m)
+		e.methods[m] = decorate(h)
+	}
+	// HEAD is served by the GET handler unless it has its own, see HandlerFor
+	if h, ok := e.methods[http.MethodGet]; ok {
+		if _, ok := e.methods[http.MethodHead]; !ok {
+			e.methods[http.MethodHead] = h
+		}
+	}
+	// no route has its own handler for the empty method
+	if h, ok := rt.HandlerFor(""); ok {
+		e.other = decorate(h)
+	}
+	return e
+}
+
+// capture matches path and returns any values captured from it, like Capture
+func (e *entry) capture(path string) (Params, bool) {
+	if e.matcher == nil {
+		return e.route.Capture(path)
+	}
+	return e.matcher.match(path)
+}
+
+// handlerFor returns the decorated handler the route has for method, like HandlerFor
+func (e *entry) handlerFor(method string) (http.Handler, bool) {
+	if h, ok := e.methods[method]; ok {
+		return h, true
+	}
+	return e.other, e.other != nil
+}
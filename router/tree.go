@@ -0,0 +1,201 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+)
+
+// node is a radix tree node keyed on the path, holding the routes whose key ends here
+type node struct {
+	path     string
+	children []*node
+	// exact routes match only the full key
+	exact []*entry
+	// patterns are template and glob routes whose literal prefix is the key, they still
+	// need to Capture
+	patterns []*entry
+	// prefixes match the key and everything beneath it
+	prefixes []*entry
+}
+
+// insert returns the node for key, splitting edges as needed
+func (n *node) insert(key string) *node {
+	for key != "" {
+		i := n.child(key[0])
+		if i < 0 {
+			child := &node{path: key}
+			n.children = append(n.children, child)
+			return child
+		}
+		child := n.children[i]
+		l := commonPrefix(child.path, key)
+		if l < len(child.path) {
+			split := &node{path: child.path[:l], children: []*node{child}}
+			child.path = child.path[l:]
+			n.children[i] = split
+			child = split
+		}
+		key = key[l:]
+		n = child
+	}
+	return n
+}
+
+func (n *node) child(c byte) int {
+	for i, child := range n.children {
+		if child.path[0] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// walk returns the nodes whose key is a prefix of path, shortest first,
+// and whether the last of them is keyed on the whole path
+func (n *node) walk(path string) ([]*node, bool) {
+	nodes := []*node{n}
+	for path != "" {
+		i := n.child(path[0])
+		if i < 0 || !strings.HasPrefix(path, n.children[i].path) {
+			return nodes, false
+		}
+		n = n.children[i]
+		path = path[len(n.path):]
+		nodes = append(nodes, n)
+	}
+	return nodes, true
+}
+
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// tier holds the routes for one host, or for any host
+type tier struct {
+	root node
+	// fallback routes can't be placed in the tree and are tried in registration order
+	fallback []*entry
+	foldCase bool
+}
+
+func (t *tier) key(k string) string {
+	if t.foldCase {
+		return strings.ToLower(k)
+	}
+	return k
+}
+
+func (t *tier) add(e *entry) {
+	rt, ok := e.route.(route)
+	if !ok {
+		t.fallback = append(t.fallback, e)
+		return
+	}
+	switch m := rt.matcher.(type) {
+	case textMatcher:
+		n := t.root.insert(t.key(m.path))
+		n.exact = append(n.exact, e)
+	case prefixMatcher:
+		n := t.root.insert(t.key(m.prefix))
+		n.prefixes = append(n.prefixes, e)
+	case patternMatcher:
+		n := t.root.insert(t.key(m.static()))
+		n.patterns = append(n.patterns, e)
+	case globMatcher:
+		n := t.root.insert(t.key(m.static()))
+		n.patterns = append(n.patterns, e)
+	default:
+		t.fallback = append(t.fallback, e)
+	}
+}
+
+// lookup returns the most specific route matching path whose conditions r meets: an
+// exact text route, then the route with the longest literal prefix (templates and globs
+// before plain prefixes), then fallbacks
+func (t *tier) lookup(r *http.Request, path string) (*entry, Params, bool) {
+	nodes, exact := t.root.walk(t.key(path))
+	if exact {
+		for _, e := range nodes[len(nodes)-1].exact {
+			if e.route.MatchRequest(r) {
+				return e, nil, true
+			}
+		}
+	}
+	for i := len(nodes) - 1; i >= 0; i-- {
+		for _, e := range nodes[i].patterns {
+			if params, ok := e.capture(path); ok && e.route.MatchRequest(r) {
+				return e, params, true
+			}
+		}
+		for _, e := range nodes[i].prefixes {
+			if e.route.MatchRequest(r) {
+				return e, nil, true
+			}
+		}
+	}
+	for _, e := range t.fallback {
+		if params, ok := e.capture(path); ok && e.route.MatchRequest(r) {
+			return e, params, true
+		}
+	}
+	return nil, nil, false
+}
+
+// index finds routes by host then path, exact hosts are preferred to wildcard hosts,
+// which are preferred to routes for any host
+type index struct {
+	hosts     map[string]*tier
+	wildcards map[string]*tier
+	any       tier
+}
+
+func newIndex(foldCase bool) *index {
+	return &index{
+		hosts:     map[string]*tier{},
+		wildcards: map[string]*tier{},
+		any:       tier{foldCase: foldCase},
+	}
+}
+
+func (x *index) add(e *entry) {
+	hosts := e.route.Hosts()
+	if len(hosts) == 0 {
+		x.any.add(e)
+		return
+	}
+	for _, h := range hosts {
+		h = canonicalHost(h)
+		tiers, key := x.hosts, h
+		if strings.HasPrefix(h, "*.") {
+			tiers, key = x.wildcards, h[1:]
+		}
+		t, ok := tiers[key]
+		if !ok {
+			t = &tier{foldCase: x.any.foldCase}
+			tiers[key] = t
+		}
+		t.add(e)
+	}
+}
+
+// lookup returns the route for r, path is the canonical form of the request path
+func (x *index) lookup(r *http.Request, path string) (*entry, Params, bool) {
+	host := canonicalHost(r.Host)
+	if t, ok := x.hosts[host]; ok {
+		if e, params, ok := t.lookup(r, path); ok {
+			return e, params, true
+		}
+	}
+	if i := strings.IndexByte(host, '.'); i > 0 {
+		if t, ok := x.wildcards[host[i:]]; ok {
+			if e, params, ok := t.lookup(r, path); ok {
+				return e, params, true
+			}
+		}
+	}
+	return x.any.lookup(r, path)
+}
@@ -0,0 +1,226 @@
+package router
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+)
+
+type ProblemKind string
+
+const (
+	// Unreachable routes can never be matched because other routes always win
+	Unreachable ProblemKind = "unreachable"
+	// Conflict routes overlap another route with different permits
+	Conflict ProblemKind = "conflict"
+	// EmptyPermit routes permit no methods, or no users, groups or roles
+	EmptyPermit ProblemKind = "empty-permit"
+)
+
+// Problem is an issue found in a set of routes by Validate
+type Problem struct {
+	Kind  ProblemKind
+	Route Route
+	// Other is the route responsible, if any
+	Other  Route
+	Reason string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s %s", p.Kind, describe(p.Route), p.Reason)
+}
+
+// Validate reports unreachable routes, routes overlapping others with different
+// permits and routes with empty permits among the routes currently served
+func (o *Router) Validate() []Problem {
+	return validate(o.Routes())
+}
+
+// Validate reports problems with the routes in the table, see Router.Validate
+func (t *Table) Validate() []Problem {
+	return validate(t.Routes())
+}
+
+// routeSet holds the routes for one host key in the shape the index sees them
+type routeSet struct {
+	exact    map[string]Route
+	prefixes map[string]Route
+	patterns map[string]Route
+	regexes  map[string]Route
+	routes   []Route
+}
+
+func validate(routes []Route) []Problem {
+	problems := []Problem{}
+	sets := map[string]*routeSet{}
+	keys := []string{}
+	for _, r := range routes {
+		p := r.Permitted()
+		if len(p.Methods()) == 0 || len(p.Users()) == 0 && len(p.Groups()) == 0 && len(p.Roles()) == 0 {
+			problems = append(problems, Problem{Kind: EmptyPermit, Route: r, Reason: "permits nobody"})
+		}
+		hosts := r.Hosts()
+		if len(hosts) == 0 {
+			hosts = []string{""}
+		}
+		for _, h := range hosts {
+			h = canonicalHost(h)
+			set, ok := sets[h]
+			if !ok {
+				set = &routeSet{
+					exact:    map[string]Route{},
+					prefixes: map[string]Route{},
+					patterns: map[string]Route{},
+					regexes:  map[string]Route{},
+				}
+				sets[h] = set
+				keys = append(keys, h)
+			}
+			problems = append(problems, set.add(r)...)
+		}
+	}
+	for _, h := range keys {
+		problems = append(problems, sets[h].overlaps()...)
+	}
+	return problems
+}
+
+// add records r, reporting it unreachable if an equivalent unconditional route came first
+func (s *routeSet) add(r Route) []Problem {
+	var seen map[string]Route
+	var key string
+	if rt, ok := r.(route); ok {
+		switch m := rt.matcher.(type) {
+		case textMatcher:
+			seen, key = s.exact, m.path
+		case prefixMatcher:
+			seen, key = s.prefixes, m.prefix
+		case patternMatcher:
+			seen, key = s.patterns, m.pattern
+		case globMatcher:
+			seen, key = s.patterns, m.pattern
+		case regexMatcher:
+			seen, key = s.regexes, m.pattern.String()
+		}
+	}
+	if seen == nil {
+		s.routes = append(s.routes, r)
+		return nil
+	}
+	if first, ok := seen[key]; ok {
+		problems := []Problem{{Kind: Unreachable, Route: r, Other: first, Reason: "duplicates " + describe(first)}}
+		if !first.Permitted().Equal(r.Permitted()) {
+			problems = append(problems, Problem{Kind: Conflict, Route: r, Other: first, Reason: "has different permits to " + describe(first)})
+		}
+		return problems
+	}
+	// routes with conditions let requests fall through to later routes
+	if len(r.Conditions()) == 0 {
+		seen[key] = r
+	}
+	s.routes = append(s.routes, r)
+	return nil
+}
+
+// overlaps reports regex routes shadowed by prefix routes and routes overlapping
+// more specific ones with different permits
+func (s *routeSet) overlaps() []Problem {
+	problems := []Problem{}
+	conflict := func(r, other Route, why string) {
+		if !r.Permitted().Equal(other.Permitted()) {
+			problems = append(problems, Problem{Kind: Conflict, Route: r, Other: other, Reason: why + " " + describe(other) + " with different permits"})
+		}
+	}
+	for _, r := range s.routes {
+		rt, ok := r.(route)
+		if !ok {
+			continue
+		}
+		switch m := rt.matcher.(type) {
+		case regexMatcher:
+			literal, anchored := anchoredPrefix(m.pattern)
+			if shadow := s.coveringPrefix(literal, anchored); shadow != nil {
+				problems = append(problems, Problem{Kind: Unreachable, Route: r, Other: shadow, Reason: "is shadowed by " + describe(shadow)})
+				continue
+			}
+			for _, path := range sortedKeys(s.exact) {
+				if m.pattern.MatchString(path) {
+					conflict(r, s.exact[path], "overlaps")
+				}
+			}
+			for _, prefix := range sortedKeys(s.prefixes) {
+				if anchored && strings.HasPrefix(prefix, literal) || !anchored && m.pattern.MatchString(prefix) {
+					conflict(r, s.prefixes[prefix], "overlaps")
+				}
+			}
+		case patternMatcher, globMatcher:
+			for _, path := range sortedKeys(s.exact) {
+				if _, ok := m.match(path); ok {
+					conflict(r, s.exact[path], "overlaps")
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// coveringPrefix returns a prefix route matching every path starting with literal
+func (s *routeSet) coveringPrefix(literal string, anchored bool) Route {
+	if !anchored {
+		literal = ""
+	}
+	var best Route
+	for _, prefix := range sortedKeys(s.prefixes) {
+		// every request path starts with a slash
+		if strings.HasPrefix(literal, prefix) || prefix == "/" {
+			best = s.prefixes[prefix]
+		}
+	}
+	return best
+}
+
+// anchoredPrefix returns the literal text a regex must begin with, and whether it is
+// anchored to the start of the path at all
+func anchoredPrefix(re *regexp.Regexp) (string, bool) {
+	s, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+	s = s.Simplify()
+	if s.Op == syntax.OpBeginText {
+		return "", true
+	}
+	if s.Op != syntax.OpConcat || len(s.Sub) == 0 || s.Sub[0].Op != syntax.OpBeginText {
+		return "", false
+	}
+	literal := ""
+	for _, sub := range s.Sub[1:] {
+		if sub.Op != syntax.OpLiteral || sub.Flags&syntax.FoldCase != 0 {
+			break
+		}
+		literal += string(sub.Rune)
+	}
+	return literal, true
+}
+
+func sortedKeys(m map[string]Route) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func describe(r Route) string {
+	s := fmt.Sprintf("%v", r)
+	if hosts := r.Hosts(); len(hosts) > 0 {
+		s = strings.Join(hosts, ",") + " " + s
+	}
+	if when := r.Conditions(); len(when) > 0 {
+		s += " when " + describeMatchers(when)
+	}
+	return fmt.Sprintf("%q", s)
+}
@@ -0,0 +1,44 @@
+package router_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stuart-warren/serveit/access"
+	"github.com/stuart-warren/serveit/router"
+)
+
+func TestValidate(t *testing.T) {
+	ro := access.BlankPermit().MethodRO().AllowUsers("ALL")
+	rw := access.BlankPermit().MethodRW().AllowUsers("some.admin")
+
+	table := router.NewTable()
+	table.Handle(router.NewPrefixRoute("/").Permit(ro))
+	table.Handle(router.NewPrefixRoute("/access/").Permit(rw))
+	table.Handle(router.NewPrefixRoute("/access/").Permit(ro))
+	table.Handle(router.NewRegexRoute(regexp.MustCompile(`^/access/.*\.txt$`)).Permit(ro))
+	table.Handle(router.NewTextRoute("/access/index.html").Permit(ro))
+	table.Handle(router.NewPatternRoute("/access/{file}").Permit(rw))
+	table.Handle(router.NewTextRoute("/empty"))
+	table.Handle(router.NewPrefixRoute("/docs/").Permit(access.BlankPermit().MethodRW().AllowRoles("editor")))
+
+	table.Handle(router.NewTextRoute("/api/v1").Host("api.example.com").Permit(ro))
+	table.Handle(router.NewRegexRoute(regexp.MustCompile(`^/api/v[0-9]+$`)).Host("api.example.com").Permit(rw))
+
+	got := []string{}
+	for _, p := range table.Validate() {
+		got = append(got, p.String())
+	}
+	want := []string{
+		`unreachable: "/access/" duplicates "/access/"`,
+		`conflict: "/access/" has different permits to "/access/"`,
+		`empty-permit: "/empty" permits nobody`,
+		`unreachable: "^/access/.*\\.txt$" is shadowed by "/access/"`,
+		`conflict: "/access/{file}" overlaps "/access/index.html" with different permits`,
+		`conflict: "api.example.com ^/api/v[0-9]+$" overlaps "api.example.com /api/v1" with different permits`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
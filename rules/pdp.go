@@ -0,0 +1,233 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/stuart-warren/serveit/access"
+	"github.com/stuart-warren/serveit/identity"
+	"github.com/stuart-warren/serveit/network"
+	"github.com/stuart-warren/serveit/router"
+)
+
+// PDPConfig configures a rule delegating decisions to an external policy decision point
+// speaking the Open Policy Agent data API, see PDP
+type PDPConfig struct {
+	url        string
+	client     *http.Client
+	timeout    time.Duration
+	failOpen   bool
+	cacheTTL   time.Duration
+	maxEntries int
+	now        func() time.Time
+}
+
+// NewPDPConfig returns a config querying url, such as
+// http://localhost:8181/v1/data/serveit/allow, failing closed after a 2 second timeout
+// without caching decisions
+func NewPDPConfig(url string) PDPConfig {
+	return PDPConfig{
+		url:        url,
+		client:     http.DefaultClient,
+		timeout:    2 * time.Second,
+		maxEntries: 10000,
+		now:        time.Now,
+	}
+}
+
+func (c PDPConfig) WithClient(client *http.Client) PDPConfig {
+	c.client = client
+	return c
+}
+
+// WithTimeout limits how long a query may take, including any retries by the client
+func (c PDPConfig) WithTimeout(timeout time.Duration) PDPConfig {
+	c.timeout = timeout
+	return c
+}
+
+// WithFailOpen allows requests when the PDP can't be queried or gives an invalid
+// response, rather than denying them
+func (c PDPConfig) WithFailOpen(failOpen bool) PDPConfig {
+	c.failOpen = failOpen
+	return c
+}
+
+// WithCache reuses decisions for identical input for ttl, keeping at most maxEntries
+func (c PDPConfig) WithCache(ttl time.Duration, maxEntries int) PDPConfig {
+	c.cacheTTL, c.maxEntries = ttl, maxEntries
+	return c
+}
+
+// WithClock sets the clock cached decisions expire by
+func (c PDPConfig) WithClock(now func() time.Time) PDPConfig {
+	c.now = now
+	return c
+}
+
+// PDPInput is the input document sent to the PDP for each request
+type PDPInput struct {
+	Method   string            `json:"method"`
+	Host     string            `json:"host"`
+	Path     string            `json:"path"`
+	Client   string            `json:"client,omitempty"`
+	Identity *PDPIdentity      `json:"identity"`
+	Route    PDPRoute          `json:"route"`
+	Params   map[string]string `json:"params,omitempty"`
+	Permit   access.Permitted  `json:"permit"`
+}
+
+// PDPIdentity is the verified identity of the client, nil if anonymous
+type PDPIdentity struct {
+	Subject string   `json:"subject,omitempty"`
+	Email   string   `json:"email,omitempty"`
+	Groups  []string `json:"groups,omitempty"`
+	Method  string   `json:"method,omitempty"`
+}
+
+// PDPRoute is the matched route, Kind is empty for routes router.KindOf doesn't know
+type PDPRoute struct {
+	Kind    string   `json:"kind,omitempty"`
+	Pattern string   `json:"pattern"`
+	Hosts   []string `json:"hosts,omitempty"`
+}
+
+// pdpResult is the PDP's response, result is either a boolean or an object with an
+// allow boolean and optional reason. An undefined result denies the request.
+type pdpResult struct {
+	Result *json.RawMessage `json:"result"`
+}
+
+type pdpEntry struct {
+	decision router.Decision
+	expires  time.Time
+}
+
+// PDP allows the requests an external policy decision point allows. Each is sent as
+// {"input": PDPInput} in a POST to the configured url, which must respond with a result
+// of true, or of {"allow": true}, to allow it.
+func PDP(c PDPConfig) router.Rule {
+	var mu sync.Mutex
+	cache := map[string]pdpEntry{}
+	return func(w http.ResponseWriter, r *http.Request, route router.Route) router.Decision {
+		body, err := json.Marshal(struct {
+			Input PDPInput `json:"input"`
+		}{pdpInput(r, route)})
+		if err != nil {
+			return c.failed(err)
+		}
+		key := string(body)
+		if c.cacheTTL > 0 {
+			mu.Lock()
+			e, ok := cache[key]
+			mu.Unlock()
+			if ok && c.now().Before(e.expires) {
+				return e.decision
+			}
+		}
+		d, err := c.query(r.Context(), body)
+		if err != nil {
+			return c.failed(err)
+		}
+		if c.cacheTTL > 0 {
+			now := c.now()
+			mu.Lock()
+			if len(cache) >= c.maxEntries {
+				for k, e := range cache {
+					if !now.Before(e.expires) {
+						delete(cache, k)
+					}
+				}
+				if len(cache) >= c.maxEntries {
+					cache = map[string]pdpEntry{}
+				}
+			}
+			cache[key] = pdpEntry{decision: d, expires: now.Add(c.cacheTTL)}
+			mu.Unlock()
+		}
+		return d
+	}
+}
+
+func pdpInput(r *http.Request, route router.Route) PDPInput {
+	in := PDPInput{
+		Method: r.Method,
+		Host:   r.Host,
+		Path:   r.URL.Path,
+		Route:  PDPRoute{Pattern: fmt.Sprintf("%v", route), Hosts: route.Hosts()},
+		Params: router.ParamsFromContext(r.Context()),
+		Permit: route.Permitted(),
+	}
+	if kind, pattern, ok := router.KindOf(route); ok {
+		in.Route.Kind, in.Route.Pattern = kind, pattern
+	}
+	if ip := network.ClientIP(r); ip != nil {
+		in.Client = ip.String()
+	}
+	if id, ok := identity.FromRequest(r); ok {
+		in.Identity = &PDPIdentity{Subject: id.Subject, Email: id.Email, Groups: id.Groups, Method: id.Method}
+	}
+	return in
+}
+
+func (c PDPConfig) query(ctx context.Context, body []byte) (router.Decision, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return router.Decision{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return router.Decision{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, resp.Body)
+		return router.Decision{}, fmt.Errorf("pdp responded %s", resp.Status)
+	}
+	res := pdpResult{}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return router.Decision{}, fmt.Errorf("invalid pdp response: %v", err)
+	}
+	if res.Result == nil {
+		return router.Deny("pdp", "no decision"), nil
+	}
+	var allowed bool
+	if err := json.Unmarshal(*res.Result, &allowed); err == nil {
+		if allowed {
+			return router.Allow("pdp", "allowed"), nil
+		}
+		return router.Deny("pdp", "denied"), nil
+	}
+	var result struct {
+		Allow  *bool  `json:"allow"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(*res.Result, &result); err != nil || result.Allow == nil {
+		return router.Decision{}, fmt.Errorf("invalid pdp result %s", *res.Result)
+	}
+	d := router.Deny("pdp", "denied")
+	if *result.Allow {
+		d = router.Allow("pdp", "allowed")
+	}
+	if result.Reason != "" {
+		d.Reason = result.Reason
+	}
+	return d, nil
+}
+
+func (c PDPConfig) failed(err error) router.Decision {
+	if c.failOpen {
+		return router.Allow("pdp", "failing open: "+err.Error())
+	}
+	return router.Deny("pdp", "failing closed: "+err.Error())
+}
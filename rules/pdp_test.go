@@ -0,0 +1,106 @@
+package rules_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stuart-warren/serveit/access"
+	"github.com/stuart-warren/serveit/identity"
+	"github.com/stuart-warren/serveit/router"
+	"github.com/stuart-warren/serveit/rules"
+)
+
+// opa stands in for an Open Policy Agent allowing admins to do anything and anyone to
+// GET, counting the queries it answers
+func opa(t *testing.T, queries *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(queries, 1)
+		var body struct {
+			Input rules.PDPInput `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("bad input: %v", err)
+		}
+		in := body.Input
+		switch {
+		case in.Route.Kind != "pattern" || in.Route.Pattern != "/docs/{id}" || in.Params["id"] != "a":
+			t.Errorf("got route %+v params %v", in.Route, in.Params)
+		case in.Identity != nil && in.Identity.Email == "admin@example.com":
+			w.Write([]byte(`{"result": {"allow": true, "reason": "admin"}}`))
+		case in.Method == "GET":
+			w.Write([]byte(`{"result": true}`))
+		case in.Identity == nil:
+			w.Write([]byte(`{}`))
+		default:
+			w.Write([]byte(`{"result": false}`))
+		}
+	}))
+}
+
+func TestPDP(t *testing.T) {
+	var queries int32
+	srv := opa(t, &queries)
+	defer srv.Close()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	rule := rules.PDP(rules.NewPDPConfig(srv.URL).WithCache(time.Minute, 100).WithClock(func() time.Time { return now }))
+	mux := router.NewRuleRouter(http.NotFoundHandler(), rule)
+	mux.Handle(router.NewPatternRoute("/docs/{id}").Permit(access.BlankPermit().AllowMethods("ALL").DenyUsers("banned@example.com")))
+
+	tests := []struct {
+		method, user string
+		want         bool
+		reason       string
+	}{
+		{"PUT", "admin@example.com", true, "admin"},
+		{"GET", "someone@example.com", true, "allowed"},
+		{"PUT", "someone@example.com", false, "denied"},
+		{"PUT", "", false, "no decision"},
+		{"GET", "banned@example.com", false, `user "banned@example.com" denied`},
+	}
+	for _, tt := range tests {
+		e, _ := mux.ExplainFor(tt.method, "/docs/a", tt.user)
+		if e.Allowed != tt.want || e.Decisions[0].Reason != tt.reason {
+			t.Errorf("%s as %q: got %v %q", tt.method, tt.user, e.Allowed, e.Decisions[0].Reason)
+		}
+	}
+	if atomic.LoadInt32(&queries) != 4 {
+		t.Errorf("got %d queries", queries)
+	}
+	mux.ExplainFor("PUT", "/docs/a", "admin@example.com")
+	if atomic.LoadInt32(&queries) != 4 {
+		t.Errorf("decision not cached, got %d queries", queries)
+	}
+	now = now.Add(2 * time.Minute)
+	mux.ExplainFor("PUT", "/docs/a", "admin@example.com")
+	if atomic.LoadInt32(&queries) != 5 {
+		t.Errorf("cached decision didn't expire, got %d queries", queries)
+	}
+}
+
+func TestPDPFailure(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte(`{"result": true}`))
+	}))
+	defer slow.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"result": "yes"}`))
+	}))
+	defer broken.Close()
+	route := router.NewPrefixRoute("/").Permit(access.BlankPermit().MethodRO())
+	r := request(&identity.Identity{Email: "a@example.com"})
+
+	for _, url := range []string{slow.URL, broken.URL} {
+		config := rules.NewPDPConfig(url).WithTimeout(50 * time.Millisecond)
+		if d := rules.PDP(config)(httptest.NewRecorder(), r, route); d.Allowed {
+			t.Errorf("%s: failed open by default: %s", url, d)
+		}
+		if d := rules.PDP(config.WithFailOpen(true))(httptest.NewRecorder(), r, route); !d.Allowed {
+			t.Errorf("%s: didn't fail open: %s", url, d)
+		}
+	}
+}
@@ -1,8 +1,13 @@
 package rules
 
 import (
+	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/stuart-warren/serveit/access"
+	"github.com/stuart-warren/serveit/identity"
+	"github.com/stuart-warren/serveit/network"
 	"github.com/stuart-warren/serveit/router"
 )
 
@@ -15,21 +20,252 @@ var DenyAll = func(w http.ResponseWriter, r *http.Request, route router.Route) b
 }
 
 var CheckMethod = func(w http.ResponseWriter, r *http.Request, route router.Route) bool {
+	return Method(w, r, route).Allowed
+}
+
+// CheckUser allows users the route permits by email or subject, as verified by an
+// authenticator, see User. It never trusts request headers.
+var CheckUser = func(w http.ResponseWriter, r *http.Request, route router.Route) bool {
+	return User(w, r, route).Allowed
+}
+
+var CheckGroup = func(w http.ResponseWriter, r *http.Request, route router.Route) bool {
+	return Group(w, r, route).Allowed
+}
+
+// Method allows requests using a method the route permits
+var Method router.Rule = func(w http.ResponseWriter, r *http.Request, route router.Route) router.Decision {
 	for _, m := range route.Permitted().Methods() {
 		if m == "ALL" || m == r.Method {
+			return router.Allow("method", r.Method+" permitted")
+		}
+	}
+	return router.Deny("method", r.Method+" not permitted")
+}
+
+// User allows users the route permits by email or subject, where * in a permitted user
+// matches anything in a verified email, so *@example.com permits everyone with an
+// example.com email.
+// access.Authenticated and access.AllUsers permit any verified identity and
+// access.Anonymous permits clients without one.
+var User router.Rule = func(w http.ResponseWriter, r *http.Request, route router.Route) router.Decision {
+	id, ok := identity.FromRequest(r)
+	for _, u := range route.Permitted().Users() {
+		if access.MatchUser(u, ok, id.Email, id.Subject) {
+			return router.Allow("user", fmt.Sprintf("user %q permitted", u))
+		}
+	}
+	if !ok {
+		return router.Deny("user", "anonymous not permitted")
+	}
+	return router.Deny("user", fmt.Sprintf("user %q not permitted", id.Name()))
+}
+
+// Group allows members of any group the route permits
+var Group router.Rule = func(w http.ResponseWriter, r *http.Request, route router.Route) router.Decision {
+	id, ok := identity.FromRequest(r)
+	if !ok {
+		return router.Deny("group", "anonymous not permitted")
+	}
+	for _, g := range route.Permitted().Groups() {
+		if id.InGroup(g) {
+			return router.Allow("group", fmt.Sprintf("group %q permitted", g))
+		}
+	}
+	return router.Deny("group", fmt.Sprintf("groups %q not permitted", id.Groups))
+}
+
+// Role allows users holding a role the route permits, directly or through a role that
+// inherits it, and using a method their role allows. It abstains if the route permits no
+// roles.
+func Role(roles access.Roles) router.Rule {
+	return func(w http.ResponseWriter, r *http.Request, route router.Route) router.Decision {
+		permitted := route.Permitted().Roles()
+		if len(permitted) == 0 {
+			return router.Abstain("role", "no roles permitted")
+		}
+		id, ok := identity.FromRequest(r)
+		if !ok {
+			return router.Deny("role", "anonymous not permitted")
+		}
+		held := heldRoles(roles, id)
+		for _, h := range held {
+			for _, satisfied := range roles.Satisfies(h) {
+				if !contains(permitted, satisfied) {
+					continue
+				}
+				if methods := roles.Methods(h); len(methods) > 0 && !contains(methods, "ALL") && !contains(methods, r.Method) {
+					continue
+				}
+				if satisfied == h {
+					return router.Allow("role", fmt.Sprintf("role %q permitted", h))
+				}
+				return router.Allow("role", fmt.Sprintf("role %q permitted through %q", satisfied, h))
+			}
+		}
+		return router.Deny("role", fmt.Sprintf("roles %q not permitted to %s", held, r.Method))
+	}
+}
+
+// heldRoles returns the roles assigned to id, by user or group, in definition order
+func heldRoles(roles access.Roles, id identity.Identity) []string {
+	held := []string{}
+	for _, name := range roles.Names() {
+		role, _ := roles.Role(name)
+		if matchAnyUser(role.Users, id) {
+			held = append(held, name)
+			continue
+		}
+		for _, g := range role.Groups {
+			if id.InGroup(g) {
+				held = append(held, name)
+				break
+			}
+		}
+	}
+	return held
+}
+
+func matchAnyUser(users []string, id identity.Identity) bool {
+	for _, u := range users {
+		if access.MatchUser(u, true, id.Email, id.Subject) {
 			return true
 		}
 	}
 	return false
 }
 
-var CheckUser = func(w http.ResponseWriter, r *http.Request, route router.Route) bool {
-	users := route.Permitted().Users()
-	for _, u := range users {
-		// FIXME - insecure
-		if u == "ALL" || u == r.Header.Get("User") {
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
 			return true
 		}
 	}
 	return false
 }
+
+// Network allows clients within a network the route permits, abstaining if it permits
+// any network. Clients behind proxies are only found if the router trusts them, see
+// router.WithTrustedProxies.
+var Network router.Rule = func(w http.ResponseWriter, r *http.Request, route router.Route) router.Decision {
+	networks := route.Permitted().ParsedNetworks()
+	if len(networks) == 0 {
+		return router.Abstain("network", "any network permitted")
+	}
+	in, reason, _ := network.ClientIn(r, networks)
+	if in {
+		return router.Allow("network", reason+" permitted")
+	}
+	return router.Deny("network", reason+" not permitted")
+}
+
+// Window allows requests while the route's permit applies, see TimeWindow
+var Window = TimeWindow(time.Now)
+
+// TimeWindow allows requests between the permit's not before and not after times and
+// during any of its schedules, by the clock now, abstaining if the permit always applies
+func TimeWindow(now func() time.Time) router.Rule {
+	return func(w http.ResponseWriter, r *http.Request, route router.Route) router.Decision {
+		p := route.Permitted()
+		if p.NotBefore().IsZero() && p.NotAfter().IsZero() && len(p.Schedules()) == 0 {
+			return router.Abstain("window", "always permitted")
+		}
+		t := now()
+		if nb := p.NotBefore(); !nb.IsZero() && t.Before(nb) {
+			return router.Deny("window", "not permitted until "+nb.Format(time.RFC3339))
+		}
+		if na := p.NotAfter(); !na.IsZero() && t.After(na) {
+			return router.Deny("window", "expired at "+na.Format(time.RFC3339))
+		}
+		if len(p.Schedules()) == 0 {
+			return router.Allow("window", "within validity period")
+		}
+		for i, sched := range p.ParsedSchedules() {
+			if sched.Contains(t) {
+				return router.Allow("window", fmt.Sprintf("within %q", p.Schedules()[i]))
+			}
+		}
+		return router.Deny("window", fmt.Sprintf("outside %q", p.Schedules()))
+	}
+}
+
+// Bool adapts a rule returning router.Decision to the func NewRouter takes
+func Bool(rule router.Rule) func(w http.ResponseWriter, r *http.Request, route router.Route) bool {
+	return func(w http.ResponseWriter, r *http.Request, route router.Route) bool {
+		d := rule(w, r, route)
+		return d.Allowed && !d.Abstained
+	}
+}
+
+// All allows requests no rule denies and at least one allows, stopping at the first denial
+func All(rules ...router.Rule) router.Rule {
+	return func(w http.ResponseWriter, r *http.Request, route router.Route) router.Decision {
+		d := router.Abstain("all", "no rule decided")
+		for _, rule := range rules {
+			step := rule(w, r, route)
+			d.Steps = append(d.Steps, step)
+			if step.Abstained {
+				continue
+			}
+			if !step.Allowed {
+				d.Allowed, d.Abstained, d.Reason = false, false, "denied by "+step.Rule
+				return d
+			}
+			d.Allowed, d.Abstained, d.Reason = true, false, "all rules allowed"
+		}
+		return d
+	}
+}
+
+// Any allows requests at least one rule allows, stopping at the first
+func Any(rules ...router.Rule) router.Rule {
+	return func(w http.ResponseWriter, r *http.Request, route router.Route) router.Decision {
+		d := router.Abstain("any", "no rule decided")
+		for _, rule := range rules {
+			step := rule(w, r, route)
+			d.Steps = append(d.Steps, step)
+			if step.Abstained {
+				continue
+			}
+			if step.Allowed {
+				d.Allowed, d.Abstained, d.Reason = true, false, "allowed by "+step.Rule
+				return d
+			}
+			d.Allowed, d.Abstained, d.Reason = false, false, "no rule allowed"
+		}
+		return d
+	}
+}
+
+// Not allows requests rule denies and denies those it allows, abstaining when it does
+func Not(rule router.Rule) router.Rule {
+	return func(w http.ResponseWriter, r *http.Request, route router.Route) router.Decision {
+		step := rule(w, r, route)
+		d := router.Decision{Rule: "not", Allowed: !step.Allowed, Abstained: step.Abstained, Steps: []router.Decision{step}}
+		switch {
+		case step.Abstained:
+			d.Allowed, d.Reason = false, step.Rule+" abstained"
+		case step.Allowed:
+			d.Reason = step.Rule + " allowed"
+		default:
+			d.Reason = step.Rule + " denied"
+		}
+		return d
+	}
+}
+
+// FirstMatch decides as the first rule that doesn't abstain
+func FirstMatch(rules ...router.Rule) router.Rule {
+	return func(w http.ResponseWriter, r *http.Request, route router.Route) router.Decision {
+		d := router.Abstain("first-match", "no rule decided")
+		for _, rule := range rules {
+			step := rule(w, r, route)
+			d.Steps = append(d.Steps, step)
+			if !step.Abstained {
+				d.Allowed, d.Abstained, d.Reason = step.Allowed, false, "decided by "+step.Rule
+				return d
+			}
+		}
+		return d
+	}
+}
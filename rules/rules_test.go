@@ -0,0 +1,384 @@
+package rules_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stuart-warren/serveit/access"
+	"github.com/stuart-warren/serveit/identity"
+	"github.com/stuart-warren/serveit/network"
+	"github.com/stuart-warren/serveit/router"
+	"github.com/stuart-warren/serveit/rules"
+)
+
+func request(id *identity.Identity) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	if id != nil {
+		r = r.WithContext(identity.NewContext(r.Context(), *id))
+	}
+	return r
+}
+
+func TestCheckGroup(t *testing.T) {
+	route := router.NewPrefixRoute("/").Permit(access.BlankPermit().MethodRO().AllowGroups("admins", "editors"))
+	tests := []struct {
+		id   *identity.Identity
+		want bool
+	}{
+		{&identity.Identity{Email: "a@example.com", Groups: []string{"staff", "editors"}}, true},
+		{&identity.Identity{Email: "a@example.com", Groups: []string{"staff"}}, false},
+		{&identity.Identity{Email: "a@example.com"}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := rules.CheckGroup(httptest.NewRecorder(), request(tt.id), route); got != tt.want {
+			t.Errorf("%v: got %v", tt.id, got)
+		}
+	}
+	r := request(nil)
+	r.Header.Set("Groups", "admins")
+	if rules.CheckGroup(httptest.NewRecorder(), r, route) {
+		t.Error("trusted a Groups header")
+	}
+}
+
+func TestCheckUser(t *testing.T) {
+	route := router.NewPrefixRoute("/").Permit(access.BlankPermit().MethodRO().AllowUsers("some.admin@example.com", "1234"))
+	tests := []struct {
+		id   *identity.Identity
+		want bool
+	}{
+		{&identity.Identity{Email: "some.admin@example.com"}, true},
+		{&identity.Identity{Subject: "1234"}, true},
+		{&identity.Identity{Email: "other@example.com", Subject: "5678"}, false},
+		{&identity.Identity{}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := rules.CheckUser(httptest.NewRecorder(), request(tt.id), route); got != tt.want {
+			t.Errorf("%v: got %v", tt.id, got)
+		}
+	}
+	r := request(nil)
+	r.Header.Set("User", "some.admin@example.com")
+	if rules.CheckUser(httptest.NewRecorder(), r, route) {
+		t.Error("trusted a User header")
+	}
+}
+
+func constant(name string, d router.Decision) router.Rule {
+	return func(w http.ResponseWriter, r *http.Request, route router.Route) router.Decision {
+		d.Rule = name
+		return d
+	}
+}
+
+func TestCombinators(t *testing.T) {
+	allow := constant("allow", router.Allow("", ""))
+	deny := constant("deny", router.Deny("", ""))
+	abstain := constant("abstain", router.Abstain("", ""))
+
+	tests := []struct {
+		name      string
+		rule      router.Rule
+		allowed   bool
+		abstained bool
+	}{
+		{"all allow", rules.All(allow, allow), true, false},
+		{"all deny", rules.All(allow, deny, allow), false, false},
+		{"all abstain", rules.All(abstain, allow), true, false},
+		{"all only abstain", rules.All(abstain), false, true},
+		{"any allow", rules.Any(deny, allow), true, false},
+		{"any deny", rules.Any(deny, abstain), false, false},
+		{"any only abstain", rules.Any(), false, true},
+		{"not allow", rules.Not(allow), false, false},
+		{"not deny", rules.Not(deny), true, false},
+		{"not abstain", rules.Not(abstain), false, true},
+		{"first match", rules.FirstMatch(abstain, deny, allow), false, false},
+		{"first match allow", rules.FirstMatch(abstain, allow, deny), true, false},
+	}
+	route := router.NewPrefixRoute("/")
+	for _, tt := range tests {
+		d := tt.rule(httptest.NewRecorder(), request(nil), route)
+		if d.Allowed != tt.allowed || d.Abstained != tt.abstained {
+			t.Errorf("%s: got %s", tt.name, d)
+		}
+	}
+}
+
+func TestRouterReasons(t *testing.T) {
+	mux := router.NewRuleRouter(http.NotFoundHandler(), rules.All(rules.Method, rules.Any(rules.User, rules.Group)))
+	mux.Handle(router.NewPrefixRoute("/").Permit(access.BlankPermit().MethodRO().AllowUsers("some.admin").AllowGroups("admins")))
+
+	e, _ := mux.ExplainFor("PUT", "/x", "some.admin")
+	if e.Allowed || e.Reason != `denied: all denied: denied by method [method denied: PUT not permitted]` {
+		t.Errorf("got %q", e.Reason)
+	}
+	e, _ = mux.ExplainFor("GET", "/x", "someone")
+	want := `denied: all denied: denied by any [method allowed: GET permitted; any denied: no rule allowed [user denied: user "someone" not permitted; group denied: groups [] not permitted]]`
+	if e.Allowed || e.Reason != want {
+		t.Errorf("got %q\nwant %q", e.Reason, want)
+	}
+	e, _ = mux.ExplainFor("GET", "/x", "some.admin")
+	if !e.Allowed {
+		t.Errorf("got %q", e.Reason)
+	}
+}
+
+func TestDenyOverridesAllow(t *testing.T) {
+	permit := access.BlankPermit().AllowMethods("ALL").AllowUsers("ALL").AllowGroups("staff").
+		DenyMethods("DELETE").DenyUsers("contractor@example.com").DenyGroups("contractors")
+	route := router.NewPrefixRoute("/").Permit(permit)
+	// routers apply denials whatever their rule
+	muxes := map[string]*router.Router{
+		"rule": router.NewRuleRouter(nil, rules.All(rules.Method, rules.Any(rules.User, rules.Group))),
+		"bool": router.NewRouter(nil, func(w http.ResponseWriter, r *http.Request, route router.Route) bool {
+			return rules.CheckUser(w, r, route) && rules.CheckMethod(w, r, route)
+		}),
+		"allowAll": router.NewRouter(nil, rules.AllowAll),
+	}
+	for _, mux := range muxes {
+		mux.Handle(route)
+	}
+
+	tests := []struct {
+		method string
+		id     identity.Identity
+		want   bool
+	}{
+		{"GET", identity.Identity{Email: "a@example.com", Groups: []string{"staff"}}, true},
+		{"DELETE", identity.Identity{Email: "a@example.com", Groups: []string{"staff"}}, false},
+		{"GET", identity.Identity{Email: "contractor@example.com"}, false},
+		{"GET", identity.Identity{Email: "b@example.com", Groups: []string{"staff", "contractors"}}, false},
+	}
+	for _, tt := range tests {
+		r := request(&tt.id)
+		r.Method = tt.method
+		for name, mux := range muxes {
+			if e := mux.Explain(r); e.Allowed != tt.want {
+				t.Errorf("%s: %s %v: got %s", name, tt.method, tt.id, e.Reason)
+			}
+		}
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	rule := rules.All(rules.Method, rules.Network)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	muxes := map[network.Header]*router.Router{}
+	for _, header := range []network.Header{network.XForwardedFor, network.Forwarded} {
+		mux := router.NewRuleRouter(ok, rule).WithTrustedProxies(header, "10.0.0.1", "10.0.1.0/24")
+		mux.Handle(router.NewPrefixRoute("/metrics").Permit(access.BlankPermit().MethodRO().AllowNetworks("192.168.10.0/24").DenyNetworks("192.168.10.66")))
+		mux.Handle(router.NewPrefixRoute("/").Permit(access.BlankPermit().MethodRO()))
+		muxes[header] = mux
+	}
+	xff, fwd := network.XForwardedFor, network.Forwarded
+	tests := []struct {
+		header                       network.Header
+		path, remote, xff, forwarded string
+		want                         int
+	}{
+		{xff, "/metrics", "192.168.10.5:1234", "", "", http.StatusOK},
+		{xff, "/metrics", "192.168.11.5:1234", "", "", http.StatusForbidden},
+		{xff, "/metrics", "192.168.10.66:1234", "", "", http.StatusForbidden},
+		{xff, "/", "192.168.11.5:1234", "", "", http.StatusOK},
+		// forwarded by a trusted proxy
+		{xff, "/metrics", "10.0.0.1:1234", "192.168.10.5", "", http.StatusOK},
+		{xff, "/metrics", "10.0.0.1:1234", "192.168.11.5", "", http.StatusForbidden},
+		// a client can't spoof its address through a trusted proxy
+		{xff, "/metrics", "10.0.0.1:1234", "192.168.10.5, 192.168.11.5", "", http.StatusForbidden},
+		// chains of trusted proxies are skipped
+		{xff, "/metrics", "10.0.0.1:1234", "192.168.10.5, 10.0.1.7", "", http.StatusOK},
+		// an untrusted peer's headers are ignored
+		{xff, "/metrics", "192.168.11.5:1234", "192.168.10.5", "", http.StatusForbidden},
+		// a Forwarded header the client sent is passed on by proxies appending to
+		// X-Forwarded-For, and must not be believed
+		{xff, "/metrics", "10.0.0.1:1234", "192.168.11.5", "for=192.168.10.5", http.StatusForbidden},
+		{xff, "/metrics", "10.0.0.1:1234", "", "for=192.168.10.5", http.StatusForbidden},
+		{fwd, "/metrics", "10.0.0.1:1234", "", `for="192.168.10.5:4711";proto=https, for=10.0.1.7`, http.StatusOK},
+		{fwd, "/metrics", "10.0.0.1:1234", "192.168.10.5", "for=192.168.11.5", http.StatusForbidden},
+		{fwd, "/metrics", "10.0.0.1:1234", "192.168.10.5", "", http.StatusForbidden},
+		{fwd, "/metrics", "10.0.0.1:1234", "", `for="[2001:db8::1]:80"`, http.StatusForbidden},
+		// addresses that can't be parsed don't match allowed networks
+		{fwd, "/metrics", "10.0.0.1:1234", "", "for=_hidden", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.path, nil)
+		r.RemoteAddr = tt.remote
+		if tt.xff != "" {
+			r.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		if tt.forwarded != "" {
+			r.Header.Set("Forwarded", tt.forwarded)
+		}
+		w := httptest.NewRecorder()
+		muxes[tt.header].ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("header %d %s from %s xff %q forwarded %q: got %d, want %d", tt.header, tt.path, tt.remote, tt.xff, tt.forwarded, w.Code, tt.want)
+		}
+	}
+}
+
+func TestInvalidNetworkPanics(t *testing.T) {
+	for _, permit := range []func(...string) access.Permitted{access.BlankPermit().AllowNetworks, access.BlankPermit().DenyNetworks} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("invalid network accepted")
+				}
+			}()
+			permit("not-a-network")
+		}()
+	}
+}
+
+func TestRole(t *testing.T) {
+	roles := access.NewRoles().
+		Define("viewer").AllowMethods("viewer", "GET", "HEAD").AssignGroups("viewer", "staff").
+		Define("editor", "viewer").AllowMethods("editor", "PUT", "POST").AssignUsers("editor", "ed@example.com").
+		Define("admin", "editor").AllowMethods("admin", "DELETE").AssignGroups("admin", "admins")
+	rule := rules.All(rules.Method, rules.Role(roles))
+	mux := router.NewRuleRouter(http.NotFoundHandler(), rule)
+	mux.Handle(router.NewPrefixRoute("/docs/").Permit(access.BlankPermit().AllowMethods("ALL").AllowRoles("viewer")))
+	mux.Handle(router.NewPrefixRoute("/admin/").Permit(access.BlankPermit().AllowMethods("ALL").AllowRoles("admin")))
+	staff := identity.Identity{Email: "s@example.com", Groups: []string{"staff"}}
+	editor := identity.Identity{Email: "ed@example.com"}
+	admin := identity.Identity{Subject: "123", Groups: []string{"admins"}}
+	tests := []struct {
+		method, path string
+		id           *identity.Identity
+		want         bool
+	}{
+		{"GET", "/docs/a", &staff, true},
+		{"PUT", "/docs/a", &staff, false},
+		{"PUT", "/docs/a", &editor, true},
+		{"DELETE", "/docs/a", &editor, false},
+		{"DELETE", "/docs/a", &admin, true},
+		{"GET", "/admin/", &editor, false},
+		{"GET", "/admin/", &admin, true},
+		{"GET", "/docs/a", &identity.Identity{Email: "x@example.com"}, false},
+		{"GET", "/docs/a", nil, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.id != nil {
+			r = r.WithContext(identity.NewContext(r.Context(), *tt.id))
+		}
+		if e := mux.Explain(r); e.Allowed != tt.want {
+			t.Errorf("%s %s as %v: got %v %s", tt.method, tt.path, tt.id, e.Allowed, e.Reason)
+		}
+	}
+	r := httptest.NewRequest("PUT", "/docs/a", nil)
+	r = r.WithContext(identity.NewContext(r.Context(), admin))
+	if e := mux.Explain(r); e.Decisions[0].Steps[1].Reason != `role "viewer" permitted through "admin"` {
+		t.Errorf("got %q", e.Decisions[0].Steps[1].Reason)
+	}
+}
+
+func TestDefineUndefinedRolePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic")
+		}
+	}()
+	access.NewRoles().Define("admin", "editor")
+}
+
+func TestUserPatterns(t *testing.T) {
+	staff := &identity.Identity{Email: "a@example.com"}
+	contractor := &identity.Identity{Email: "c@contractors.example.com"}
+	other := &identity.Identity{Email: "a@example.org", Subject: "auth0|123"}
+	tests := []struct {
+		users []string
+		deny  []string
+		id    *identity.Identity
+		want  bool
+	}{
+		{[]string{"*@example.com"}, nil, staff, true},
+		{[]string{"*@example.com"}, nil, contractor, false},
+		{[]string{"*@example.com"}, nil, other, false},
+		{[]string{"*@example.com"}, nil, nil, false},
+		{[]string{"*@*example.com"}, nil, contractor, true},
+		// wildcards only match verified emails, not subjects that look like them
+		{[]string{"auth0|*"}, nil, other, false},
+		{[]string{"auth0|123"}, nil, other, true},
+		{[]string{"*@example.com"}, nil, &identity.Identity{Subject: "x@example.com"}, false},
+		{[]string{"x@example.com"}, nil, &identity.Identity{Subject: "x@example.com"}, true},
+		{[]string{"AUTHENTICATED"}, nil, other, true},
+		{[]string{"AUTHENTICATED"}, nil, nil, false},
+		{[]string{"ALL"}, nil, staff, true},
+		{[]string{"ALL"}, nil, nil, false},
+		{[]string{"ANONYMOUS"}, nil, nil, true},
+		{[]string{"ANONYMOUS"}, nil, staff, false},
+		{[]string{"ANONYMOUS", "AUTHENTICATED"}, nil, staff, true},
+		{[]string{"ANONYMOUS", "AUTHENTICATED"}, []string{"*@example.com"}, contractor, true},
+		{[]string{"ANONYMOUS", "AUTHENTICATED"}, []string{"*@contractors.example.com"}, contractor, false},
+		{[]string{"ANONYMOUS", "AUTHENTICATED"}, []string{"ANONYMOUS"}, nil, false},
+	}
+	mux := router.NewRuleRouter(nil, rules.User)
+	for _, tt := range tests {
+		table := router.NewTable()
+		table.Handle(router.NewPrefixRoute("/").Permit(access.BlankPermit().MethodRO().AllowUsers(tt.users...).DenyUsers(tt.deny...)))
+		mux.Replace(table)
+		if e := mux.Explain(request(tt.id)); e.Allowed != tt.want {
+			t.Errorf("%q deny %q as %v: got %s", tt.users, tt.deny, tt.id, e.Reason)
+		}
+	}
+}
+
+func TestTimeWindow(t *testing.T) {
+	at := func(s string) func() time.Time {
+		return func() time.Time {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				panic(err)
+			}
+			return t
+		}
+	}
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	temporary := access.BlankPermit().MethodRW().AllowFrom(start).AllowUntil(end)
+	officeHours := access.BlankPermit().MethodRW().AllowDuring("Mon-Fri 08:00-18:00 Europe/London")
+	overnight := access.BlankPermit().MethodRW().AllowDuring("Fri-Sat 22:00-06:00")
+	tests := []struct {
+		permit access.Permitted
+		now    string
+		want   bool
+	}{
+		{temporary, "2026-02-28T23:59:59Z", false},
+		{temporary, "2026-03-15T12:00:00Z", true},
+		{temporary, "2026-04-01T00:00:01Z", false},
+		// Tuesday, British Summer Time
+		{officeHours, "2026-06-02T07:30:00Z", true},
+		{officeHours, "2026-06-02T17:30:00Z", false},
+		// Tuesday, Greenwich Mean Time
+		{officeHours, "2026-01-06T07:30:00Z", false},
+		{officeHours, "2026-01-06T17:30:00Z", true},
+		// Saturday
+		{officeHours, "2026-06-06T12:00:00Z", false},
+		// Saturday morning is in Friday's window, Sunday night is not in any
+		{overnight, "2026-06-06T05:00:00Z", true},
+		{overnight, "2026-06-07T05:00:00Z", true},
+		{overnight, "2026-06-08T05:00:00Z", false},
+		{overnight, "2026-06-05T21:59:00Z", false},
+	}
+	for _, tt := range tests {
+		route := router.NewPrefixRoute("/upload/").Permit(tt.permit)
+		if d := rules.TimeWindow(at(tt.now))(httptest.NewRecorder(), request(nil), route); d.Allowed != tt.want {
+			t.Errorf("%s %v: got %s", tt.now, tt.permit.Schedules(), d)
+		}
+	}
+	route := router.NewPrefixRoute("/").Permit(access.BlankPermit().MethodRO())
+	if d := rules.Window(httptest.NewRecorder(), request(nil), route); !d.Abstained {
+		t.Errorf("got %s", d)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("invalid schedule accepted")
+		}
+	}()
+	access.BlankPermit().AllowDuring("weekdays")
+}